@@ -1,14 +1,25 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/api"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/auth"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/scraper"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout limits waiting for open requests on shutdown
+const shutdownTimeout = 5 * time.Second
+
 func main() {
 	r := gin.Default()
 	cfg, err := config.InitBackendConfig()
@@ -22,14 +33,96 @@ func main() {
 	}
 	defer db.Close()
 	taskRepo := dao.NewTaskRepository(db)
+	updated, merged, err := taskRepo.BackfillNormalizedFEN()
+	if err != nil {
+		panic(err)
+	}
+	if updated > 0 || merged > 0 {
+		log.Printf("normalized positions of %d tasks, merged %d duplicate tasks\n", updated, merged)
+	}
+	rated, err := taskRepo.BackfillRatings()
+	if err != nil {
+		panic(err)
+	}
+	if rated > 0 {
+		log.Printf("started ratings of %d tasks from their target elo\n", rated)
+	}
+	userRepo := dao.NewUserRepository(db)
+	bookRepo := dao.NewBookRepository(db)
+	jobRepo := dao.NewJobRepository(db, cfg.Jobs.Retention)
 
 	scrapperFactory := scraper.NewLichessGameScraperFactory(cfg, taskRepo)
+	defer scrapperFactory.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queueDone := make(chan struct{})
+	go func() {
+		defer close(queueDone)
+		scraper.NewJobQueue(cfg, jobRepo, scrapperFactory).Run(ctx)
+	}()
 
-	taskApi := api.NewTaskApi(taskRepo, scrapperFactory)
+	secret := []byte(cfg.Auth.Secret)
+	if len(secret) == 0 {
+		log.Println("AUTH_SECRET is not set, issued tokens will be invalid after restart")
+		secret, err = auth.RandomSecret()
+		if err != nil {
+			panic(err)
+		}
+	}
+	tokens := auth.NewTokenIssuer(secret, cfg.Auth.TokenTTL)
+
+	taskApi := api.NewTaskApi(taskRepo, userRepo, bookRepo, jobRepo, cfg.Jobs.StreamInterval)
+	userApi := api.NewUserApi(userRepo, tokens)
+	bookApi := api.NewBookApi(bookRepo, taskRepo, jobRepo)
+	gamesApi := api.NewGamesApi(jobRepo, cfg.Jobs.MaxPgnSize)
+
+	r.POST("/user/register", userApi.Register)
+	r.POST("/user/login", userApi.Login)
+	r.GET("/user/me", auth.RequireUser(tokens), userApi.Me)
 
 	r.GET("/task", taskApi.Task)
-	r.GET("/task/:username", taskApi.StartTask)
+	r.GET("/task/:username", auth.OptionalUser(tokens), taskApi.StartTask)
+	r.GET("/puzzle/:id", taskApi.TaskByID)
+	r.GET("/task/:username/diagram.svg", taskApi.DiagramSVG)
+	r.GET("/task/:username/diagram.png", taskApi.DiagramPNG)
+	r.GET("/task/:username/solution.gif", taskApi.SolutionGIF)
+	r.POST("/task/:username/attempt", auth.OptionalUser(tokens), taskApi.Attempt)
 	r.GET("/job/:job_id", taskApi.GetJobStatus)
+	r.GET("/job/:job_id/events", taskApi.JobEvents)
+	r.DELETE("/job/:job_id", auth.OptionalUser(tokens), taskApi.CancelJob)
+	r.GET("/jobs", auth.RequireUser(tokens), taskApi.ListJobs)
+	r.POST("/job/:job_id/book", auth.RequireUser(tokens), bookApi.CreateBookFromJob)
+	r.POST("/games/pgn", auth.OptionalUser(tokens), gamesApi.UploadPgn)
+
+	r.GET("/books", bookApi.GetBooks)
+	r.POST("/book", auth.RequireUser(tokens), bookApi.CreateBook)
+	r.GET("/book/:id", bookApi.GetBook)
+	r.PUT("/book/:id", auth.RequireUser(tokens), bookApi.UpdateBook)
+	r.DELETE("/book/:id", auth.RequireUser(tokens), bookApi.DeleteBook)
+	r.GET("/book/:id/progress", auth.RequireUser(tokens), bookApi.Progress)
+	r.GET("/book/:id/pdf", bookApi.Pdf)
 
-	r.Run(":" + cfg.Server.Port)
+	server := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	log.Println("shutting down, returning running jobs to the queue")
+
+	// queue is stopped first, so jobs are released while the database is still connected
+	cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println(err)
+	}
+	<-queueDone
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/scraper"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// fileCheckpoint is import progress of single file
+type fileCheckpoint struct {
+	// Games is number of games from the beginning of file which are already processed
+	Games int  `json:"games"`
+	Done  bool `json:"done"`
+}
+
+// checkpoint keeps progress of files by their absolute paths, so resumed import can be run from another directory
+type checkpoint map[string]fileCheckpoint
+
+func checkpointKey(path string) (string, error) {
+	return filepath.Abs(path)
+}
+
+func loadCheckpoint(path string) (checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return checkpoint{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// save replaces checkpoint file atomically, so interruption never leaves it half written
+func (c checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// importPgn generates tasks from games of pgn files (plain, .gz or .zst) and saves them to database,
+// interrupted import continues from the checkpoint when run again with the same files
+func importPgn(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	source := fs.String("source", scraper.PgnSourceName, "source saved in game data of generated tasks")
+	checkpointPath := fs.String("checkpoint", "import-checkpoint.json", "file keeping number of processed games of every file")
+	batch := fs.Int("batch", 20, "number of games analyzed between checkpoints")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("pgn files should be set")
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("batch should be positive")
+	}
+
+	progress, err := loadCheckpoint(*checkpointPath)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.InitScraperConfig()
+	if err != nil {
+		return err
+	}
+	dbClient, err := db.NewDbClientScraper(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbClient.Close()
+
+	opts := cfg.GeneratorOptions()
+	stockfishPath, stockfishArgs := cfg.Stockfish.Path, cfg.Stockfish.Args
+	pool := puzgen.NewEnginePool(cfg.Stockfish.PoolSize, func() (puzgen.Engine, error) {
+		return puzgen.SetupEngine(stockfishPath, opts, stockfishArgs...)
+	})
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			log.Println("interrupted, finishing current searches")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	imp := importer{
+		ctx:            ctx,
+		source:         *source,
+		batch:          *batch,
+		pool:           pool,
+		opts:           opts,
+		taskRepo:       dao.NewTaskRepository(dbClient),
+		progress:       progress,
+		checkpointPath: *checkpointPath,
+	}
+	for _, path := range fs.Args() {
+		if err := imp.importFile(path); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("import is interrupted, run it again to resume from %s", *checkpointPath)
+			}
+			return fmt.Errorf("error importing %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+type importer struct {
+	ctx      context.Context
+	source   string
+	batch    int
+	pool     *puzgen.EnginePool
+	opts     puzgen.GeneratorOptions
+	taskRepo dao.TaskRepository
+
+	progress       checkpoint
+	checkpointPath string
+}
+
+func (i *importer) importFile(path string) error {
+	key, err := checkpointKey(path)
+	if err != nil {
+		return err
+	}
+	if i.progress[key].Done {
+		log.Printf("%s is already imported\n", path)
+		return nil
+	}
+
+	r, err := openPgn(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	reader := pgn.NewReader(r)
+	skip := i.progress[key].Games
+	for reader.Games() < skip {
+		if _, err := reader.NextRaw(); err != nil {
+			return fmt.Errorf("file has less games than checkpoint: %v", err)
+		}
+	}
+	if skip > 0 {
+		log.Printf("%s: resuming after %d games\n", path, skip)
+	}
+
+	saved := 0
+	for {
+		games, err := i.readBatch(path, reader)
+		eof := err == io.EOF
+		if err != nil && !eof {
+			return err
+		}
+
+		if len(games) > 0 {
+			var mu sync.Mutex
+			onGame := func(ind int, tasks []puzgen.Task) error {
+				if len(tasks) == 0 {
+					return nil
+				}
+				for j := range tasks {
+					tasks[j].GameData.Source = i.source
+				}
+				tasks, _, err := i.taskRepo.InsertAllTasks(tasks)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				saved += len(tasks)
+				mu.Unlock()
+				return nil
+			}
+			if _, err := puzgen.AnalyzeAllGames(i.ctx, i.pool, games, onGame, i.opts); err != nil {
+				return err
+			}
+		}
+
+		i.progress[key] = fileCheckpoint{Games: reader.Games(), Done: eof}
+		if err := i.progress.save(i.checkpointPath); err != nil {
+			return err
+		}
+		log.Printf("%s: %d games processed, %d tasks saved\n", path, reader.Games(), saved)
+		if eof {
+			return nil
+		}
+	}
+}
+
+// readBatch reads next games of file, games which can't be parsed are logged and skipped,
+// io.EOF is returned with the last games
+func (i *importer) readBatch(path string, reader *pgn.Reader) ([]*pgn.Game, error) {
+	games := make([]*pgn.Game, 0, i.batch)
+	for len(games) < i.batch {
+		text, err := reader.NextRaw()
+		if err != nil {
+			return games, err
+		}
+		game, err := pgn.Parse(text)
+		if err != nil {
+			log.Printf("%s: game %d is skipped: %v\n", path, reader.Games(), err)
+			continue
+		}
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+type pgnFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (f pgnFile) Close() error {
+	var firstErr error
+	for _, c := range f.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openPgn opens pgn file decompressing it by extension
+func openPgn(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return pgnFile{gz, []io.Closer{gz, f}}, nil
+	case strings.HasSuffix(path, ".zst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		zrc := zr.IOReadCloser()
+		return pgnFile{zrc, []io.Closer{zrc, f}}, nil
+	default:
+		return f, nil
+	}
+}
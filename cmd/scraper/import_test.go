@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// importPGN has three games, the second one can't be parsed since it has illegal move
+const importPGN = `[White "a"]
+[Black "b"]
+[WhiteElo "1500"]
+[BlackElo "1500"]
+[UTCDate "2021.05.01"]
+[UTCTime "12:00:00"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+
+[White "c"]
+[Black "d"]
+[WhiteElo "1500"]
+[BlackElo "1500"]
+[UTCDate "2021.05.01"]
+[UTCTime "12:10:00"]
+
+1. e4 e4 1/2-1/2
+
+[White "e"]
+[Black "f"]
+[WhiteElo "1500"]
+[BlackElo "1500"]
+[UTCDate "2021.05.01"]
+[UTCTime "12:20:00"]
+
+1. d4 d5 2. c4 1-0
+`
+
+type importTaskRepository struct {
+	dao.TaskRepository
+}
+
+func (importTaskRepository) InsertAllTasks(tasks []puzgen.Task) ([]puzgen.Task, int, error) {
+	return tasks, 0, nil
+}
+
+// newTestImporter returns importer with engines which find nothing, every analyzed position is counted in searches
+func newTestImporter(t *testing.T, progress checkpoint) (*importer, func() int) {
+	engines := make([]*puzgen.ScriptedEngine, 0)
+	pool := puzgen.NewEnginePool(1, func() (puzgen.Engine, error) {
+		e := puzgen.NewScriptedEngine(nil)
+		engines = append(engines, e)
+		return e, nil
+	})
+	t.Cleanup(pool.Close)
+
+	imp := &importer{
+		ctx:            context.Background(),
+		source:         "test",
+		batch:          2,
+		pool:           pool,
+		opts:           puzgen.DefaultGeneratorOptions(),
+		taskRepo:       importTaskRepository{},
+		progress:       progress,
+		checkpointPath: filepath.Join(t.TempDir(), "checkpoint.json"),
+	}
+	searches := func() int {
+		n := 0
+		for _, e := range engines {
+			n += len(e.Searches)
+		}
+		return n
+	}
+	return imp, searches
+}
+
+func writeImportPGN(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "games.pgn")
+	if err := ioutil.WriteFile(path, []byte(importPGN), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportFile(t *testing.T) {
+	path := writeImportPGN(t)
+	imp, searches := newTestImporter(t, checkpoint{})
+
+	if err := imp.importFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// positions after every move of the first and the third games
+	if n := searches(); n != 7 {
+		t.Errorf("expected 7 analyzed positions, got %d", n)
+	}
+	saved, err := loadCheckpoint(imp.checkpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress := saved[path]; progress.Games != 3 || !progress.Done {
+		t.Errorf("expected finished file with 3 games in checkpoint, got %+v", saved)
+	}
+}
+
+func TestImportFileResume(t *testing.T) {
+	path := writeImportPGN(t)
+	imp, searches := newTestImporter(t, checkpoint{path: {Games: 1}})
+
+	if err := imp.importFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// the first game is already processed and the second one is skipped
+	if n := searches(); n != 3 {
+		t.Errorf("expected 3 analyzed positions of the third game, got %d", n)
+	}
+	if progress := imp.progress[path]; progress.Games != 3 || !progress.Done {
+		t.Errorf("expected finished file with 3 games, got %+v", progress)
+	}
+}
+
+func TestImportFileDone(t *testing.T) {
+	// file isn't even opened if it is already imported
+	path := filepath.Join(t.TempDir(), "missing.pgn")
+	imp, searches := newTestImporter(t, checkpoint{path: {Games: 3, Done: true}})
+
+	if err := imp.importFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := searches(); n != 0 {
+		t.Errorf("imported file shouldn't be analyzed, got %d searches", n)
+	}
+}
+
+func TestCheckpointKey(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(wd, "games.pgn")
+	for _, path := range []string{"games.pgn", "./games.pgn", "testdata/../games.pgn", expected} {
+		key, err := checkpointKey(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != expected {
+			t.Errorf("expected key %s for %s, got %s", expected, path, key)
+		}
+	}
+}
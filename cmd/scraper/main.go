@@ -5,9 +5,23 @@ import (
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/scraper"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "pdf" {
+		if err := exportPdf(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := importPgn(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	cfg, err := config.InitScraperConfig()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/worksheet"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// exportPdf renders tasks from database (-tasks) or from JSON file (-in) to PDF worksheet
+func exportPdf(args []string) error {
+	fs := flag.NewFlagSet("pdf", flag.ExitOnError)
+	taskIDs := fs.String("tasks", "", "comma separated task ids to load from database")
+	in := fs.String("in", "", "JSON file with list of tasks or job result")
+	out := fs.String("o", "puzzles.pdf", "output file")
+	title := fs.String("title", "Puzzles", "worksheet title")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var tasks []puzgen.Task
+	var err error
+	switch {
+	case *in != "":
+		tasks, err = loadTasksFile(*in)
+	case *taskIDs != "":
+		tasks, err = loadTasksFromDb(strings.Split(*taskIDs, ","))
+	default:
+		return fmt.Errorf("either -tasks or -in should be set")
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return worksheet.Render(f, *title, tasks)
+}
+
+func loadTasksFile(path string) ([]puzgen.Task, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []puzgen.Task
+	if err = json.Unmarshal(data, &tasks); err == nil {
+		return tasks, nil
+	}
+	// result of /job/:job_id
+	var job struct {
+		Result struct {
+			Tasks []puzgen.Task `json:"tasks"`
+		} `json:"result"`
+	}
+	if err = json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return job.Result.Tasks, nil
+}
+
+func loadTasksFromDb(ids []string) ([]puzgen.Task, error) {
+	cfg, err := config.InitScraperConfig()
+	if err != nil {
+		return nil, err
+	}
+	dbClient, err := db.NewDbClientScraper(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer dbClient.Close()
+	taskRepo := dao.NewTaskRepository(dbClient)
+
+	tasks := make([]puzgen.Task, 0, len(ids))
+	for _, id := range ids {
+		task, err := taskRepo.GetTaskByID(strings.TrimSpace(id))
+		if err != nil {
+			return nil, err
+		}
+		if task.StartFEN == "" {
+			return nil, fmt.Errorf("task %s doesn't exist", id)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
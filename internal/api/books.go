@@ -0,0 +1,358 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/auth"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/worksheet"
+	"log"
+	"net/http"
+)
+
+type BookApi struct {
+	BookRepository dao.BookRepository
+	TaskRepository dao.TaskRepository
+	JobRepository  dao.JobRepository
+}
+
+func NewBookApi(bookRepo dao.BookRepository, taskRepo dao.TaskRepository, jobRepo dao.JobRepository) *BookApi {
+	return &BookApi{
+		bookRepo,
+		taskRepo,
+		jobRepo,
+	}
+}
+
+type bookRequest struct {
+	Title       string   `json:"title" binding:"required,max=200"`
+	Description string   `json:"description" binding:"max=2000"`
+	TaskIDs     []string `json:"task_ids" binding:"required,min=1,max=500"`
+}
+
+type bookFromJobRequest struct {
+	Title       string `json:"title" binding:"required,max=200"`
+	Description string `json:"description" binding:"max=2000"`
+}
+
+type bookProgressResponse struct {
+	dao.BookProgress
+	Total      int    `json:"total"`
+	Finished   bool   `json:"finished"`
+	NextTaskID string `json:"next_task_id,omitempty"`
+}
+
+// checkTasks makes sure that all tasks exist and none of them is repeated
+func (b *BookApi) checkTasks(taskIDs []string) error {
+	seen := make(map[string]bool, len(taskIDs))
+	for _, id := range taskIDs {
+		if seen[id] {
+			return fmt.Errorf("task %s is repeated", id)
+		}
+		seen[id] = true
+
+		task, err := b.TaskRepository.GetTaskByID(id)
+		if err != nil {
+			return err
+		}
+		if task.StartFEN == "" {
+			return fmt.Errorf("task %s doesn't exist", id)
+		}
+	}
+	return nil
+}
+
+// ownedBook loads book from path and checks that it belongs to authenticated user, response is written if it doesn't
+func (b *BookApi) ownedBook(ctx *gin.Context) (dao.Book, bool) {
+	book, err := b.BookRepository.GetBook(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return dao.Book{}, false
+	}
+	if book.Title == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return dao.Book{}, false
+	}
+	if book.Owner != auth.Username(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error": "book belongs to another user",
+		})
+		return dao.Book{}, false
+	}
+	return book, true
+}
+
+func (b *BookApi) CreateBook(ctx *gin.Context) {
+	var req bookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := b.checkTasks(req.TaskIDs); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	book, err := b.BookRepository.CreateBook(dao.Book{
+		Title:       req.Title,
+		Description: req.Description,
+		Owner:       auth.Username(ctx),
+		TaskIDs:     req.TaskIDs,
+	})
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusCreated, book)
+}
+
+func (b *BookApi) CreateBookFromJob(ctx *gin.Context) {
+	var req bookFromJobRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	job, err := b.JobRepository.GetJob(ctx.Param("job_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if job.Status == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	// tasks of anonymous jobs are public
+	if job.Owner != "" && job.Owner != auth.Username(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error": "job belongs to another user",
+		})
+		return
+	}
+	if job.Status == dao.JobFailed {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error": job.Error,
+		})
+		return
+	}
+	if job.Status != dao.JobDone {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error": "job is not finished yet",
+		})
+		return
+	}
+	if len(job.TaskIDs) == 0 {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error": "job didn't generate any tasks",
+		})
+		return
+	}
+
+	taskIDs := make([]string, 0, len(job.TaskIDs))
+	seen := make(map[string]bool, len(job.TaskIDs))
+	for _, id := range job.TaskIDs {
+		if !seen[id] {
+			seen[id] = true
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	book, err := b.BookRepository.CreateBook(dao.Book{
+		Title:       req.Title,
+		Description: req.Description,
+		Owner:       auth.Username(ctx),
+		TaskIDs:     taskIDs,
+	})
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusCreated, book)
+}
+
+func (b *BookApi) GetBook(ctx *gin.Context) {
+	book, err := b.BookRepository.GetBook(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if book.Title == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	ctx.JSON(http.StatusOK, book)
+}
+
+func (b *BookApi) GetBooks(ctx *gin.Context) {
+	owner := ctx.Query("owner")
+	if owner == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "owner is required",
+		})
+		return
+	}
+	books, err := b.BookRepository.GetBooksByOwner(owner)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, books)
+}
+
+func (b *BookApi) UpdateBook(ctx *gin.Context) {
+	var req bookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	book, ok := b.ownedBook(ctx)
+	if !ok {
+		return
+	}
+	if err := b.checkTasks(req.TaskIDs); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	book.Title = req.Title
+	book.Description = req.Description
+	book.TaskIDs = req.TaskIDs
+	if err := b.BookRepository.UpdateBook(book); err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, book)
+}
+
+func (b *BookApi) DeleteBook(ctx *gin.Context) {
+	book, ok := b.ownedBook(ctx)
+	if !ok {
+		return
+	}
+	if err := b.BookRepository.DeleteBook(book.ID.Hex()); err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (b *BookApi) Progress(ctx *gin.Context) {
+	book, err := b.BookRepository.GetBook(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if book.Title == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	progress, err := b.BookRepository.GetProgress(book.ID.Hex(), auth.Username(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	solved := make(map[string]bool, len(progress.Solved))
+	for _, id := range progress.Solved {
+		solved[id] = true
+	}
+	response := bookProgressResponse{
+		BookProgress: progress,
+		Total:        len(book.TaskIDs),
+		Finished:     true,
+	}
+	// next task is the first one in book order that isn't solved yet
+	for _, id := range book.TaskIDs {
+		if !solved[id] {
+			response.Finished = false
+			response.NextTaskID = id
+			break
+		}
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Pdf renders book tasks in book order as printable worksheet with answer key
+func (b *BookApi) Pdf(ctx *gin.Context) {
+	book, err := b.BookRepository.GetBook(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if book.Title == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	tasks := make([]puzgen.Task, 0, len(book.TaskIDs))
+	for _, id := range book.TaskIDs {
+		task, err := b.TaskRepository.GetTaskByID(id)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		// tasks could be removed after book was created
+		if task.StartFEN == "" {
+			log.Printf("task %s of book %s doesn't exist\n", id, book.ID.Hex())
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	if len(tasks) == 0 {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error": "book doesn't have any tasks",
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := worksheet.Render(&buf, book.Title, tasks); err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", book.ID.Hex()))
+	ctx.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/diagram"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDiagramSize = 400
+	minDiagramSize     = 64
+	maxDiagramSize     = 1600
+
+	// frame delays of solution animation in milliseconds
+	minFrameDelay = 100
+	maxFrameDelay = 10000
+)
+
+// diagramFromQuery builds diagram of task start position with orientation, size and options from query
+func diagramFromQuery(ctx *gin.Context, task puzgen.Task) (*diagram.Diagram, int, diagram.Options, error) {
+	d, err := diagram.FromTask(task)
+	if err != nil {
+		return nil, 0, diagram.Options{}, err
+	}
+	switch ctx.Query("orientation") {
+	case "":
+	case "white":
+		d.Flipped = false
+	case "black":
+		d.Flipped = true
+	default:
+		return nil, 0, diagram.Options{}, fmt.Errorf("orientation should be white or black")
+	}
+
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", strconv.Itoa(defaultDiagramSize)))
+	if err != nil || size < minDiagramSize || size > maxDiagramSize {
+		return nil, 0, diagram.Options{}, fmt.Errorf("size should be integer between %d and %d", minDiagramSize, maxDiagramSize)
+	}
+
+	coordinates, err := strconv.ParseBool(ctx.DefaultQuery("coordinates", "true"))
+	if err != nil {
+		return nil, 0, diagram.Options{}, fmt.Errorf("coordinates should be boolean")
+	}
+	showMove, err := strconv.ParseBool(ctx.DefaultQuery("move", "false"))
+	if err != nil {
+		return nil, 0, diagram.Options{}, fmt.Errorf("move should be boolean")
+	}
+
+	opts := diagram.Options{Coordinates: coordinates}
+	if showMove && len(task.FirstPossibleTurns) > 0 {
+		move, err := d.DecodeMove(task.FirstPossibleTurns[0].SanNotation)
+		if err != nil {
+			return nil, 0, diagram.Options{}, err
+		}
+		opts.Highlight = move
+		opts.Arrow = move
+	}
+	return d, size, opts, nil
+}
+
+func (t *TaskApi) diagram(ctx *gin.Context, contentType string, render func(task puzgen.Task, d *diagram.Diagram, buf *bytes.Buffer, size int, opts diagram.Options) error) {
+	// diagram routes share wildcard with /task/:username, so task id comes in username param
+	task, err := t.TaskRepository.GetTaskByID(ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if task.StartFEN == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	d, size, opts, err := diagramFromQuery(ctx, task)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	var buf bytes.Buffer
+	if err := render(task, d, &buf, size, opts); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+func (t *TaskApi) DiagramSVG(ctx *gin.Context) {
+	t.diagram(ctx, "image/svg+xml", func(_ puzgen.Task, d *diagram.Diagram, buf *bytes.Buffer, size int, opts diagram.Options) error {
+		return d.SVG(buf, size, opts)
+	})
+}
+
+func (t *TaskApi) DiagramPNG(ctx *gin.Context) {
+	t.diagram(ctx, "image/png", func(_ puzgen.Task, d *diagram.Diagram, buf *bytes.Buffer, size int, opts diagram.Options) error {
+		return d.PNG(buf, size, opts)
+	})
+}
+
+// SolutionGIF animates main solution line, delay query parameter sets milliseconds between moves
+func (t *TaskApi) SolutionGIF(ctx *gin.Context) {
+	opts := diagram.DefaultAnimationOptions()
+	if delayStr := ctx.Query("delay"); delayStr != "" {
+		delay, err := strconv.Atoi(delayStr)
+		if err != nil || delay < minFrameDelay || delay > maxFrameDelay {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("delay should be integer between %d and %d", minFrameDelay, maxFrameDelay),
+			})
+			return
+		}
+		opts.MoveDelay = time.Duration(delay) * time.Millisecond
+	}
+
+	t.diagram(ctx, "image/gif", func(task puzgen.Task, d *diagram.Diagram, buf *bytes.Buffer, size int, diagramOpts diagram.Options) error {
+		opts.Coordinates = diagramOpts.Coordinates
+		return diagram.SolutionGIF(buf, task, d.Flipped, size, opts)
+	})
+}
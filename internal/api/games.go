@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/auth"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/scraper"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// multipartOverhead is allowed size of multipart form besides uploaded pgn
+const multipartOverhead = 64 << 10
+
+type GamesApi struct {
+	JobRepository dao.JobRepository
+	// MaxPgnSize limits uploaded file, games are kept in job until it is run
+	MaxPgnSize int64
+}
+
+func NewGamesApi(jobRepo dao.JobRepository, maxPgnSize int64) *GamesApi {
+	return &GamesApi{
+		jobRepo,
+		maxPgnSize,
+	}
+}
+
+// UploadPgn puts analysis of games from multipart pgn file to the queue,
+// job is run and reported the same way as scraping of user games
+func (g *GamesApi) UploadPgn(ctx *gin.Context) {
+	// body is limited before parsing so large uploads are not spooled to disk, multipart headers take extra space
+	limit := g.MaxPgnSize + multipartOverhead
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+	file, err := ctx.FormFile("pgn")
+	if err != nil && ctx.Request.ContentLength > limit {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("pgn file should be at most %d bytes", g.MaxPgnSize),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "pgn file is required",
+		})
+		return
+	}
+	if file.Size > g.MaxPgnSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("pgn file should be at most %d bytes", g.MaxPgnSize),
+		})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	games, err := pgn.ReadAll(bytes.NewReader(data))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("invalid pgn: %v", err),
+		})
+		return
+	}
+	if len(games) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "pgn doesn't contain games",
+		})
+		return
+	}
+
+	job, err := g.JobRepository.CreatePgnJob(scraper.PgnSourceName, string(data), len(games), auth.Username(ctx))
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, jobCreatedResponse(job, gin.H{
+		"games": len(games),
+	}))
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"io"
+	"net/http"
+	"time"
+)
+
+// JobEvents streams job updates as server-sent events:
+// "progress" when status or counters change, "tasks" with puzzles saved since previous event
+// and final event named after job status after which stream is closed
+func (t *TaskApi) JobEvents(ctx *gin.Context) {
+	id := ctx.Param("job_id")
+	job, err := t.JobRepository.GetJob(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if job.Status == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-cache")
+	// disable response buffering in nginx
+	ctx.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(t.StreamInterval)
+	defer ticker.Stop()
+	var lastStatus dao.JobStatus
+	var lastProgress dao.JobProgress
+	sentTasks := make(map[string]bool)
+	first := true
+
+	ctx.Stream(func(w io.Writer) bool {
+		if !first {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case <-ticker.C:
+			}
+			job, err = t.JobRepository.GetJob(id)
+			if err != nil {
+				ctx.SSEvent("error", gin.H{"error": err.Error()})
+				return false
+			}
+			if job.Status == "" {
+				ctx.SSEvent("error", gin.H{"error": "job has expired"})
+				return false
+			}
+		}
+		first = false
+
+		if job.Status != lastStatus || job.JobProgress != lastProgress {
+			lastStatus, lastProgress = job.Status, job.JobProgress
+			ctx.SSEvent("progress", gin.H{
+				"status":         job.Status,
+				"progress":       job.Progress,
+				"games_fetched":  job.GamesFetched,
+				"games_analyzed": job.GamesAnalyzed,
+				"puzzles_found":  job.PuzzlesFound,
+			})
+		}
+
+		newIDs := make([]string, 0)
+		for _, taskID := range job.TaskIDs {
+			if !sentTasks[taskID] {
+				sentTasks[taskID] = true
+				newIDs = append(newIDs, taskID)
+			}
+		}
+		if len(newIDs) > 0 {
+			tasks, err := t.TaskRepository.GetTasksByIDs(newIDs)
+			if err != nil {
+				ctx.SSEvent("error", gin.H{"error": err.Error()})
+				return false
+			}
+			ctx.SSEvent("tasks", tasks)
+		}
+
+		if !job.Finished() {
+			return true
+		}
+		switch job.Status {
+		case dao.JobDone:
+			ctx.SSEvent(string(job.Status), gin.H{
+				"task_ids":           job.TaskIDs,
+				"skipped_duplicates": job.SkippedDuplicates,
+			})
+		case dao.JobFailed:
+			ctx.SSEvent(string(job.Status), gin.H{"error": job.Error})
+		default:
+			ctx.SSEvent(string(job.Status), gin.H{})
+		}
+		return false
+	})
+}
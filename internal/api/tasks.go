@@ -1,32 +1,38 @@
 package api
 
 import (
-	"crypto/md5"
+	"crypto/subtle"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/auth"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/scraper"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 )
 
 type TaskApi struct {
-	TaskRepository    dao.TaskRepository
-	TaskWorkerFactory *scraper.LichessGameScraperFactory
-	activeJobs        map[string]scraper.Worker
-	totalJobs         int
-	mu                sync.RWMutex
+	TaskRepository dao.TaskRepository
+	UserRepository dao.UserRepository
+	BookRepository dao.BookRepository
+	JobRepository  dao.JobRepository
+	// StreamInterval is how often job is checked for updates while streaming its events
+	StreamInterval time.Duration
 }
 
-func NewTaskApi(taskRepo dao.TaskRepository, taskWorker *scraper.LichessGameScraperFactory) *TaskApi {
+func NewTaskApi(taskRepo dao.TaskRepository, userRepo dao.UserRepository, bookRepo dao.BookRepository, jobRepo dao.JobRepository, streamInterval time.Duration) *TaskApi {
 	return &TaskApi{
 		taskRepo,
-		taskWorker,
-		make(map[string]scraper.Worker, 0),
-		0,
-		sync.RWMutex{},
+		userRepo,
+		bookRepo,
+		jobRepo,
+		streamInterval,
 	}
 }
 
@@ -39,16 +45,263 @@ func (t *TaskApi) Task(ctx *gin.Context) {
 		return
 	}
 
-	task, err := t.TaskRepository.GetRandomTaskForElo(elo)
+	generator := puzgen.Generator(ctx.Query("generator"))
+	switch generator {
+	case "", puzgen.CheckmateGenerator, puzgen.MaterialGenerator:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unknown generator %s", generator),
+		})
+		return
+	}
+
+	theme := puzgen.Theme(ctx.Query("theme"))
+	if theme != "" && !puzgen.IsKnownTheme(theme) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unknown theme %s", theme),
+		})
+		return
+	}
+
+	task, err := t.TaskRepository.GetRandomTaskForElo(elo, generator, theme)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, task)
+}
+
+func (t *TaskApi) TaskByID(ctx *gin.Context) {
+	id := ctx.Param("id")
+	task, err := t.TaskRepository.GetTaskByID(id)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
+	if task.StartFEN == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
 	ctx.JSON(http.StatusOK, task)
 }
 
+type attemptRequest struct {
+	Moves []string `json:"moves" binding:"required,min=1"`
+	// BookID is optional, finished attempts of authenticated users are saved as their progress in the book
+	BookID string `json:"book_id"`
+}
+
+type attemptResponse struct {
+	puzgen.AttemptResult
+	PuzzleRating *rating.Rating `json:"puzzle_rating,omitempty"`
+	SolverRating *rating.Rating `json:"solver_rating,omitempty"`
+}
+
+func (t *TaskApi) Attempt(ctx *gin.Context) {
+	// route shares wildcard with /task/:username, so task id comes in username param
+	id := ctx.Param("username")
+	var req attemptRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "moves should be non-empty list of SAN or UCI moves",
+		})
+		return
+	}
+
+	task, err := t.TaskRepository.GetTaskByID(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if task.StartFEN == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if req.BookID != "" {
+		book, err := t.BookRepository.GetBook(req.BookID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !book.HasTask(task.ID) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("task %s is not in book %s", task.ID, req.BookID),
+			})
+			return
+		}
+	}
+
+	result, err := puzgen.CheckAttempt(task, req.Moves)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	response := attemptResponse{AttemptResult: result}
+	// ratings are updated only when attempt is over: either failed or solved completely
+	if !result.Correct || result.Finished {
+		puzzleRating, solverRating, err := t.updateRatings(task, auth.Username(ctx), result.Correct)
+		if err != nil {
+			log.Println(err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		response.PuzzleRating = &puzzleRating
+		response.SolverRating = &solverRating
+
+		if username := auth.Username(ctx); req.BookID != "" && username != "" {
+			if err := t.BookRepository.RecordAttempt(req.BookID, username, task.ID, result.Correct); err != nil {
+				log.Println(err)
+				ctx.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// maxRatingRetries limits attempts to update rating which is changed concurrently by other solvers
+const maxRatingRetries = 5
+
+// updateRatings treats every finished attempt as a game between solver and puzzle, anonymous attempts still change puzzle rating.
+// Puzzle rating is updated first, so solver rating isn't changed by attempt which wasn't counted for the puzzle
+func (t *TaskApi) updateRatings(task puzgen.Task, username string, solved bool) (rating.Rating, rating.Rating, error) {
+	solver := rating.Default()
+	if username != "" {
+		var err error
+		solver, err = t.UserRepository.GetUserRating(username)
+		if err != nil {
+			return rating.Rating{}, rating.Rating{}, err
+		}
+	}
+
+	score := 0.0
+	if solved {
+		score = 1
+	}
+
+	var puzzle, newPuzzle rating.Rating
+	for i := 0; ; i++ {
+		if i == maxRatingRetries {
+			return rating.Rating{}, rating.Rating{}, fmt.Errorf("rating of task %s is changed concurrently", task.ID)
+		}
+		puzzle = task.CurrentRating()
+		newPuzzle = rating.Update(puzzle, solver, 1-score)
+		updated, err := t.TaskRepository.UpdateTaskRating(task.ID, task.Rating, newPuzzle)
+		if err != nil {
+			return rating.Rating{}, rating.Rating{}, err
+		}
+		if updated {
+			break
+		}
+		task, err = t.TaskRepository.GetTaskByID(task.ID)
+		if err != nil {
+			return rating.Rating{}, rating.Rating{}, err
+		}
+	}
+
+	newSolver := rating.Update(solver, puzzle, score)
+	if username == "" {
+		return newPuzzle, newSolver, nil
+	}
+	for i := 0; ; i++ {
+		if i == maxRatingRetries {
+			return rating.Rating{}, rating.Rating{}, fmt.Errorf("rating of user %s is changed concurrently", username)
+		}
+		updated, err := t.UserRepository.UpdateUserRating(username, solver, newSolver)
+		if err != nil {
+			return rating.Rating{}, rating.Rating{}, err
+		}
+		if updated {
+			return newPuzzle, newSolver, nil
+		}
+		solver, err = t.UserRepository.GetUserRating(username)
+		if err != nil {
+			return rating.Rating{}, rating.Rating{}, err
+		}
+		newSolver = rating.Update(solver, puzzle, score)
+	}
+}
+
+var perfTypes = map[string]bool{
+	"bullet":         true,
+	"blitz":          true,
+	"rapid":          true,
+	"classical":      true,
+	"correspondence": true,
+}
+
+// parseGameFilter reads filter of scraped games from query, dates are in YYYY-MM-DD format and both are inclusive
+func parseGameFilter(ctx *gin.Context) (dao.GameFilter, error) {
+	var filter dao.GameFilter
+	if perf := ctx.Query("perf"); perf != "" {
+		for _, perfType := range strings.Split(perf, ",") {
+			if !perfTypes[perfType] {
+				return dao.GameFilter{}, fmt.Errorf("unknown perf type %s", perfType)
+			}
+			filter.PerfTypes = append(filter.PerfTypes, perfType)
+		}
+	}
+	if rated := ctx.Query("rated"); rated != "" {
+		ratedOnly, err := strconv.ParseBool(rated)
+		if err != nil {
+			return dao.GameFilter{}, fmt.Errorf("rated should be boolean")
+		}
+		filter.RatedOnly = ratedOnly
+	}
+	switch color := ctx.Query("color"); color {
+	case "", "white", "black":
+		filter.Color = color
+	default:
+		return dao.GameFilter{}, fmt.Errorf("color should be white or black")
+	}
+	filter.Opponent = ctx.Query("opponent")
+
+	if since := ctx.Query("since"); since != "" {
+		date, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return dao.GameFilter{}, fmt.Errorf("since should be date in YYYY-MM-DD format")
+		}
+		filter.Since = primitive.NewDateTimeFromTime(date)
+	}
+	if until := ctx.Query("until"); until != "" {
+		date, err := time.Parse("2006-01-02", until)
+		if err != nil {
+			return dao.GameFilter{}, fmt.Errorf("until should be date in YYYY-MM-DD format")
+		}
+		filter.Until = primitive.NewDateTimeFromTime(date.AddDate(0, 0, 1).Add(-time.Millisecond))
+	}
+	if filter.Since != 0 && filter.Until != 0 && filter.Since > filter.Until {
+		return dao.GameFilter{}, fmt.Errorf("since should be before until")
+	}
+
+	// tasks can't be generated from games of other variants
+	switch variant := ctx.Query("variant"); variant {
+	case "":
+	case "standard":
+		filter.Variant = variant
+	default:
+		return dao.GameFilter{}, fmt.Errorf("variant %s is not supported, only standard games are analyzed", variant)
+	}
+	return filter, nil
+}
+
+// StartTask puts scraping job to the queue, it is run by one of backend replicas
 func (t *TaskApi) StartTask(ctx *gin.Context) {
 	name := ctx.Param("username")
 	lastStr := ctx.DefaultQuery("last", "20")
@@ -57,54 +310,176 @@ func (t *TaskApi) StartTask(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": "last should be positive integer",
 		})
+		return
+	}
+
+	source := ctx.DefaultQuery("source", scraper.LichessSourceName)
+	if !scraper.IsKnownSource(source) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unknown source %s", source),
+		})
+		return
 	}
 
-	worker := t.TaskWorkerFactory.CreateLichessScrapper(name, last)
-	t.totalJobs++
-	byteValue := []byte(strconv.Itoa(t.totalJobs))
-	id := fmt.Sprintf("%x", md5.Sum(byteValue))
+	filter, err := parseGameFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.activeJobs[id] = &worker
-	worker.StartWork()
+	job, err := t.JobRepository.CreateJob(source, name, last, filter, auth.Username(ctx))
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	id := job.ID.Hex()
 	log.Println(gin.H{"job_id": id})
-	ctx.JSON(http.StatusOK, gin.H{
-		"job_id": id,
-	})
+	ctx.JSON(http.StatusOK, jobCreatedResponse(job, gin.H{}))
 }
 
 func (t *TaskApi) GetJobStatus(ctx *gin.Context) {
-	id := ctx.Param("job_id")
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	worker, ok := t.activeJobs[id]
-	if !ok {
+	job, err := t.JobRepository.GetJob(ctx.Param("job_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if job.Status == "" {
 		ctx.AbortWithStatus(http.StatusNotFound)
 		return
 	}
-	done := worker.Done()
-	if done {
-		delete(t.activeJobs, id)
-		if worker.Error() != nil {
-			ctx.JSON(http.StatusOK, gin.H{
-				"done":  done,
-				"error": worker.Error().Error(),
-			})
-		} else {
-			ctx.JSON(http.StatusOK, gin.H{
-				"done":   done,
-				"result": worker.Result(),
+
+	done := job.Finished()
+	switch job.Status {
+	case dao.JobFailed:
+		ctx.JSON(http.StatusOK, gin.H{
+			"done":   done,
+			"status": job.Status,
+			"error":  job.Error,
+		})
+	case dao.JobDone:
+		tasks, err := t.TaskRepository.GetTasksByIDs(job.TaskIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
 			})
+			return
 		}
-	} else {
-		log.Println(gin.H{
-			"done":     done,
-			"progress": worker.Progress(),
+		ctx.JSON(http.StatusOK, gin.H{
+			"done":   done,
+			"status": job.Status,
+			"result": scraper.UserGamesResult{
+				Tasks:             tasks,
+				SkippedDuplicates: job.SkippedDuplicates,
+			},
 		})
+	default:
+		// puzzles of already analyzed games are returned while job is running
+		tasks, err := t.TaskRepository.GetTasksByIDs(job.TaskIDs)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		ctx.JSON(http.StatusOK, gin.H{
-			"done":     done,
-			"progress": worker.Progress(),
+			"done":           done,
+			"status":         job.Status,
+			"progress":       job.Progress,
+			"games_fetched":  job.GamesFetched,
+			"games_analyzed": job.GamesAnalyzed,
+			"puzzles_found":  job.PuzzlesFound,
+			"result": scraper.UserGamesResult{
+				Tasks:             tasks,
+				SkippedDuplicates: job.SkippedDuplicates,
+			},
+		})
+	}
+}
+
+// jobCreatedResponse adds id of created job to response, anonymous creator also gets token to cancel the job
+func jobCreatedResponse(job dao.Job, response gin.H) gin.H {
+	response["job_id"] = job.ID.Hex()
+	if job.CancelToken != "" {
+		response["cancel_token"] = job.CancelToken
+	}
+	return response
+}
+
+// CancelJob stops queued or running job, jobs started by authenticated users can be cancelled only by them
+// and anonymous jobs only with cancel_token returned on creation
+func (t *TaskApi) CancelJob(ctx *gin.Context) {
+	job, err := t.JobRepository.GetJob(ctx.Param("job_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if job.Status == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if job.Owner != "" && job.Owner != auth.Username(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error": "job belongs to another user",
+		})
+		return
+	}
+	token := ctx.Query("cancel_token")
+	if job.Owner == "" && (job.CancelToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(job.CancelToken)) != 1) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error": "cancel_token of the job is required",
+		})
+		return
+	}
+
+	cancelled, err := t.JobRepository.CancelJob(job.ID)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !cancelled {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error": "job is already finished",
+		})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListJobs shows jobs started by authenticated user, anonymous jobs are only available by their ids
+func (t *TaskApi) ListJobs(ctx *gin.Context) {
+	status := dao.JobStatus(ctx.Query("status"))
+	if status != "" && !dao.IsKnownJobStatus(status) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unknown status %s", status),
+		})
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit should be integer between 1 and 500",
 		})
+		return
+	}
+
+	jobs, err := t.JobRepository.ListJobs(auth.Username(ctx), status, int64(limit))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
+	ctx.JSON(http.StatusOK, jobs)
 }
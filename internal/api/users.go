@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/auth"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
+	"log"
+	"net/http"
+	"time"
+)
+
+type UserApi struct {
+	UserRepository dao.UserRepository
+	Tokens         *auth.TokenIssuer
+}
+
+func NewUserApi(userRepo dao.UserRepository, tokens *auth.TokenIssuer) *UserApi {
+	return &UserApi{
+		userRepo,
+		tokens,
+	}
+}
+
+type credentialsRequest struct {
+	Username string `json:"username" binding:"required,alphanum,min=3,max=32"`
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+func (u *UserApi) tokenResponse(ctx *gin.Context, status int, username string) {
+	token, expiresAt := u.Tokens.Issue(username)
+	ctx.JSON(status, gin.H{
+		"username":   username,
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+func (u *UserApi) Register(ctx *gin.Context) {
+	var req credentialsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "username should be 3-32 alphanumeric characters and password should be at least 8 characters",
+		})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	created, err := u.UserRepository.CreateUser(dao.User{
+		Username:     req.Username,
+		PasswordHash: hash,
+		Rating:       rating.Default(),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !created {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("username %s is already taken", req.Username),
+		})
+		return
+	}
+	u.tokenResponse(ctx, http.StatusCreated, req.Username)
+}
+
+func (u *UserApi) Login(ctx *gin.Context) {
+	var req credentialsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "username and password are required",
+		})
+		return
+	}
+
+	user, err := u.UserRepository.GetUser(req.Username)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if user.Username == "" || !auth.CheckPassword(user.PasswordHash, req.Password) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"error": "wrong username or password",
+		})
+		return
+	}
+	u.tokenResponse(ctx, http.StatusOK, user.Username)
+}
+
+func (u *UserApi) Me(ctx *gin.Context) {
+	user, err := u.UserRepository.GetUser(auth.Username(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if user.Username == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
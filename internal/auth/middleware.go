@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+const usernameKey = "username"
+
+func bearerToken(ctx *gin.Context) string {
+	header := ctx.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// OptionalUser stores username of authenticated user in context, anonymous requests are passed through
+func OptionalUser(issuer *TokenIssuer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := bearerToken(ctx)
+		if token == "" {
+			ctx.Next()
+			return
+		}
+		username, err := issuer.Parse(token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.Set(usernameKey, username)
+		ctx.Next()
+	}
+}
+
+// RequireUser rejects requests without valid token
+func RequireUser(issuer *TokenIssuer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		username, err := issuer.Parse(bearerToken(ctx))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.Set(usernameKey, username)
+		ctx.Next()
+	}
+}
+
+// Username returns authenticated user or empty string for anonymous requests
+func Username(ctx *gin.Context) string {
+	return ctx.GetString(usernameKey)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token is expired")
+)
+
+// TokenIssuer issues stateless tokens in form base64(username).expiry.signature signed with HMAC-SHA256
+type TokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokenIssuer(secret []byte, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{secret, ttl}
+}
+
+// RandomSecret is used when no secret is configured, tokens become invalid after restart
+func RandomSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (t *TokenIssuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (t *TokenIssuer) Issue(username string) (string, time.Time) {
+	expiresAt := time.Now().Add(t.ttl)
+	payload := fmt.Sprintf("%s.%d",
+		base64.RawURLEncoding.EncodeToString([]byte(username)),
+		expiresAt.Unix(),
+	)
+	return payload + "." + t.sign(payload), expiresAt
+}
+
+// Parse checks token signature and expiry and returns username it was issued for
+func (t *TokenIssuer) Parse(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(payload))) {
+		return "", ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", ErrExpiredToken
+	}
+	username, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	return string(username), nil
+}
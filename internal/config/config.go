@@ -1,7 +1,9 @@
 package config
 
 import (
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
 	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
 type BackendConfiguration struct {
@@ -9,13 +11,55 @@ type BackendConfiguration struct {
 		Port string `envconfig:"PORT"`
 	}
 	Database struct {
-		Address      string `envconfig:"MONGO_ADDRESS"`
-		DatabaseName string `envconfig:"MONGO_DATABASE"`
-		Collection   string `envconfig:"MONGO_COLLECTION"`
+		Address                string `envconfig:"MONGO_ADDRESS"`
+		DatabaseName           string `envconfig:"MONGO_DATABASE"`
+		Collection             string `envconfig:"MONGO_COLLECTION"`
+		UserCollection         string `envconfig:"MONGO_USER_COLLECTION" default:"users"`
+		BookCollection         string `envconfig:"MONGO_BOOK_COLLECTION" default:"books"`
+		BookProgressCollection string `envconfig:"MONGO_BOOK_PROGRESS_COLLECTION" default:"book_progress"`
+		JobCollection          string `envconfig:"MONGO_JOB_COLLECTION" default:"jobs"`
 	}
 	Stockfish struct {
-		Path string   `envconfig:"STOCKFISH_PATH"`
-		Args []string `envconfig:"STOCKFISH_ARGS"`
+		Path     string   `envconfig:"STOCKFISH_PATH"`
+		Args     []string `envconfig:"STOCKFISH_ARGS"`
+		PoolSize int      `envconfig:"STOCKFISH_POOL_SIZE" default:"2"`
+		Hash     int      `envconfig:"STOCKFISH_HASH" default:"128"`
+		Threads  int      `envconfig:"STOCKFISH_THREADS"`
+	}
+	Puzzles struct {
+		SearchDepth       int           `envconfig:"SEARCH_DEPTH" default:"6"`
+		MoveTime          time.Duration `envconfig:"SEARCH_MOVETIME"`
+		MultiPV           int           `envconfig:"SEARCH_MULTIPV" default:"6"`
+		MinMateLength     int           `envconfig:"MIN_MATE_LENGTH" default:"2"`
+		MaxMateLength     int           `envconfig:"MAX_MATE_LENGTH"`
+		ScoreTolerance    int           `envconfig:"SCORE_TOLERANCE" default:"50"`
+		MaterialThreshold int           `envconfig:"MATERIAL_THRESHOLD" default:"300"`
+		ValidationDepth   int           `envconfig:"VALIDATION_DEPTH" default:"10"`
+		RejectAmbiguous   bool          `envconfig:"REJECT_AMBIGUOUS"`
+		// KnownEvalMargin allows skipping positions using evaluations of analysed lichess games, negative disables it
+		KnownEvalMargin int `envconfig:"KNOWN_EVAL_MARGIN" default:"100"`
+	}
+	Jobs struct {
+		// Workers is number of jobs run concurrently by this replica
+		Workers           int           `envconfig:"JOB_WORKERS" default:"1"`
+		PollInterval      time.Duration `envconfig:"JOB_POLL_INTERVAL" default:"2s"`
+		HeartbeatInterval time.Duration `envconfig:"JOB_HEARTBEAT_INTERVAL" default:"2s"`
+		// StaleTimeout is time without heartbeat after which running job is considered lost with its replica
+		StaleTimeout time.Duration `envconfig:"JOB_STALE_TIMEOUT" default:"1m"`
+		// RecoverInterval is how often replica looks for stale jobs
+		RecoverInterval time.Duration `envconfig:"JOB_RECOVER_INTERVAL" default:"30s"`
+		MaxAttempts     int           `envconfig:"JOB_MAX_ATTEMPTS" default:"3"`
+		// Retention is how long finished jobs and their results can be retrieved
+		Retention time.Duration `envconfig:"JOB_RETENTION" default:"24h"`
+		// StreamInterval is how often job events stream checks job for updates
+		StreamInterval time.Duration `envconfig:"JOB_STREAM_INTERVAL" default:"1s"`
+		// MaxPgnSize limits uploaded games in bytes, they are stored in job document
+		MaxPgnSize int64 `envconfig:"JOB_MAX_PGN_SIZE" default:"1048576"`
+	}
+	Auth struct {
+		// Secret signs user tokens, random secret is generated if it is empty
+		Secret   string        `envconfig:"AUTH_SECRET"`
+		TokenTTL time.Duration `envconfig:"AUTH_TOKEN_TTL" default:"720h"`
 	}
 }
 
@@ -25,6 +69,23 @@ func InitBackendConfig() (*BackendConfiguration, error) {
 	return &config, err
 }
 
+func (c *BackendConfiguration) GeneratorOptions() puzgen.GeneratorOptions {
+	return puzgen.GeneratorOptions{
+		Depth:             c.Puzzles.SearchDepth,
+		MoveTime:          c.Puzzles.MoveTime,
+		MultiPV:           c.Puzzles.MultiPV,
+		Hash:              c.Stockfish.Hash,
+		Threads:           c.Stockfish.Threads,
+		MinMateLength:     c.Puzzles.MinMateLength,
+		MaxMateLength:     c.Puzzles.MaxMateLength,
+		ScoreTolerance:    c.Puzzles.ScoreTolerance,
+		MaterialThreshold: c.Puzzles.MaterialThreshold,
+		ValidationDepth:   c.Puzzles.ValidationDepth,
+		RejectAmbiguous:   c.Puzzles.RejectAmbiguous,
+		KnownEvalMargin:   c.Puzzles.KnownEvalMargin,
+	}
+}
+
 type ScraperConfiguration struct {
 	Database struct {
 		Address      string `envconfig:"MONGO_ADDRESS"`
@@ -34,6 +95,23 @@ type ScraperConfiguration struct {
 	Stockfish struct {
 		Path string   `envconfig:"STOCKFISH_PATH"`
 		Args []string `envconfig:"STOCKFISH_ARGS"`
+		// PoolSize is number of engines analyzing imported games concurrently
+		PoolSize int `envconfig:"STOCKFISH_POOL_SIZE" default:"2"`
+		Hash     int `envconfig:"STOCKFISH_HASH" default:"128"`
+		Threads  int `envconfig:"STOCKFISH_THREADS"`
+	}
+	Puzzles struct {
+		SearchDepth       int           `envconfig:"SEARCH_DEPTH" default:"6"`
+		MoveTime          time.Duration `envconfig:"SEARCH_MOVETIME"`
+		MultiPV           int           `envconfig:"SEARCH_MULTIPV" default:"6"`
+		MinMateLength     int           `envconfig:"MIN_MATE_LENGTH" default:"2"`
+		MaxMateLength     int           `envconfig:"MAX_MATE_LENGTH"`
+		ScoreTolerance    int           `envconfig:"SCORE_TOLERANCE" default:"50"`
+		MaterialThreshold int           `envconfig:"MATERIAL_THRESHOLD" default:"300"`
+		ValidationDepth   int           `envconfig:"VALIDATION_DEPTH" default:"10"`
+		RejectAmbiguous   bool          `envconfig:"REJECT_AMBIGUOUS"`
+		// KnownEvalMargin allows skipping positions using evaluations of analysed lichess games, negative disables it
+		KnownEvalMargin int `envconfig:"KNOWN_EVAL_MARGIN" default:"100"`
 	}
 }
 
@@ -42,3 +120,20 @@ func InitScraperConfig() (*ScraperConfiguration, error) {
 	err := envconfig.Process("", &config)
 	return &config, err
 }
+
+func (c *ScraperConfiguration) GeneratorOptions() puzgen.GeneratorOptions {
+	return puzgen.GeneratorOptions{
+		Depth:             c.Puzzles.SearchDepth,
+		MoveTime:          c.Puzzles.MoveTime,
+		MultiPV:           c.Puzzles.MultiPV,
+		Hash:              c.Stockfish.Hash,
+		Threads:           c.Stockfish.Threads,
+		MinMateLength:     c.Puzzles.MinMateLength,
+		MaxMateLength:     c.Puzzles.MaxMateLength,
+		ScoreTolerance:    c.Puzzles.ScoreTolerance,
+		MaterialThreshold: c.Puzzles.MaterialThreshold,
+		ValidationDepth:   c.Puzzles.ValidationDepth,
+		RejectAmbiguous:   c.Puzzles.RejectAmbiguous,
+		KnownEvalMargin:   c.Puzzles.KnownEvalMargin,
+	}
+}
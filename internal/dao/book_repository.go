@@ -0,0 +1,186 @@
+package dao
+
+import (
+	"context"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type Book struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Title       string             `json:"title" bson:"title"`
+	Description string             `json:"description" bson:"description"`
+	Owner       string             `json:"owner" bson:"owner"`
+	// TaskIDs keeps order in which tasks are read
+	TaskIDs   []string  `json:"task_ids" bson:"task_ids"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+func (b Book) HasTask(id string) bool {
+	for _, taskID := range b.TaskIDs {
+		if taskID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// BookProgress keeps tasks of the book that reader has already solved or failed
+type BookProgress struct {
+	BookID    string    `json:"book_id" bson:"book_id"`
+	Username  string    `json:"username" bson:"username"`
+	Solved    []string  `json:"solved" bson:"solved"`
+	Failed    []string  `json:"failed" bson:"failed"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type BookRepository interface {
+	CreateBook(book Book) (Book, error)
+
+	// GetBook returns empty book if it doesn't exist
+	GetBook(id string) (Book, error)
+
+	GetBooksByOwner(owner string) ([]Book, error)
+
+	// UpdateBook replaces title, description and tasks of the book
+	UpdateBook(book Book) error
+
+	DeleteBook(id string) error
+
+	// GetProgress returns empty progress if reader hasn't started the book yet
+	GetProgress(bookID string, username string) (BookProgress, error)
+
+	RecordAttempt(bookID string, username string, taskID string, solved bool) error
+}
+
+type bookRepository struct {
+	dbClient *db.TaskDbClient
+}
+
+func NewBookRepository(dbClient *db.TaskDbClient) BookRepository {
+	return &bookRepository{dbClient}
+}
+
+func (b *bookRepository) CreateBook(book Book) (Book, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	book.ID = primitive.NewObjectID()
+	book.CreatedAt = time.Now()
+	book.UpdatedAt = book.CreatedAt
+	if _, err := b.dbClient.BookCollection.InsertOne(ctx, book); err != nil {
+		return Book{}, err
+	}
+	return book, nil
+}
+
+func (b *bookRepository) GetBook(id string) (Book, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Book{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	cur := b.dbClient.BookCollection.FindOne(ctx, bson.D{{"_id", objectID}})
+	var book Book
+	if err := cur.Decode(&book); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Book{}, nil
+		}
+		return Book{}, err
+	}
+	return book, nil
+}
+
+func (b *bookRepository) GetBooksByOwner(owner string) ([]Book, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	cursor, err := b.dbClient.BookCollection.Find(ctx,
+		bson.D{{"owner", owner}},
+		options.Find().SetSort(bson.D{{"created_at", -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	books := make([]Book, 0)
+	if err = cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (b *bookRepository) UpdateBook(book Book) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	_, err := b.dbClient.BookCollection.UpdateOne(ctx,
+		bson.D{{"_id", book.ID}},
+		bson.D{{"$set", bson.D{
+			{"title", book.Title},
+			{"description", book.Description},
+			{"task_ids", book.TaskIDs},
+			{"updated_at", time.Now()},
+		}}},
+	)
+	return err
+}
+
+func (b *bookRepository) DeleteBook(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	if _, err = b.dbClient.BookCollection.DeleteOne(ctx, bson.D{{"_id", objectID}}); err != nil {
+		return err
+	}
+	_, err = b.dbClient.BookProgressCollection.DeleteMany(ctx, bson.D{{"book_id", id}})
+	return err
+}
+
+func (b *bookRepository) GetProgress(bookID string, username string) (BookProgress, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	cur := b.dbClient.BookProgressCollection.FindOne(ctx, bson.D{{"book_id", bookID}, {"username", username}})
+	progress := BookProgress{
+		BookID:   bookID,
+		Username: username,
+		Solved:   make([]string, 0),
+		Failed:   make([]string, 0),
+	}
+	if err := cur.Decode(&progress); err != nil && err != mongo.ErrNoDocuments {
+		return BookProgress{}, err
+	}
+	return progress, nil
+}
+
+func (b *bookRepository) RecordAttempt(bookID string, username string, taskID string, solved bool) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	field := "failed"
+	if solved {
+		field = "solved"
+	}
+	_, err := b.dbClient.BookProgressCollection.UpdateOne(ctx,
+		bson.D{{"book_id", bookID}, {"username", username}},
+		bson.D{
+			{"$addToSet", bson.D{{field, taskID}}},
+			{"$set", bson.D{{"updated_at", time.Now()}}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,400 @@
+package dao
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+func IsKnownJobStatus(status JobStatus) bool {
+	switch status {
+	case JobQueued, JobRunning, JobDone, JobFailed, JobCancelled:
+		return true
+	}
+	return false
+}
+
+// JobProgress is updated by worker while job is running
+type JobProgress struct {
+	Progress      float64 `json:"progress" bson:"progress"`
+	GamesFetched  int     `json:"games_fetched" bson:"games_fetched"`
+	GamesAnalyzed int     `json:"games_analyzed" bson:"games_analyzed"`
+	PuzzlesFound  int     `json:"puzzles_found" bson:"puzzles_found"`
+}
+
+// GameFilter restricts games scraped by job, zero fields don't filter
+type GameFilter struct {
+	// PerfTypes are speeds like blitz or correspondence
+	PerfTypes []string `json:"perf_types,omitempty" bson:"perf_types,omitempty"`
+	RatedOnly bool     `json:"rated_only,omitempty" bson:"rated_only,omitempty"`
+	// Color is color of scraped user, white or black
+	Color    string             `json:"color,omitempty" bson:"color,omitempty"`
+	Opponent string             `json:"opponent,omitempty" bson:"opponent,omitempty"`
+	Since    primitive.DateTime `json:"since,omitempty" bson:"since,omitempty"`
+	Until    primitive.DateTime `json:"until,omitempty" bson:"until,omitempty"`
+	Variant  string             `json:"variant,omitempty" bson:"variant,omitempty"`
+}
+
+func (f GameFilter) IsEmpty() bool {
+	return len(f.PerfTypes) == 0 && !f.RatedOnly && f.Color == "" && f.Opponent == "" &&
+		f.Since == 0 && f.Until == 0 && f.Variant == ""
+}
+
+// Job is a scraping of last games of user on a chess site or analysis of uploaded games stored in queue
+type Job struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Source is site games are scraped from, it is empty for jobs created before sources were introduced
+	Source   string `json:"source,omitempty" bson:"source,omitempty"`
+	Nickname string `json:"nickname" bson:"nickname"`
+	Last     int    `json:"last" bson:"last"`
+	// Filter is set if only some of user games are scraped
+	Filter *GameFilter `json:"filter,omitempty" bson:"filter,omitempty"`
+	// PGN is text of uploaded games, it is analyzed instead of scraping user games
+	PGN string `json:"-" bson:"pgn,omitempty"`
+	// Owner is user who started the job, it is empty for anonymous jobs
+	Owner string `json:"owner,omitempty" bson:"owner,omitempty"`
+	// CancelToken is given to creator of anonymous job and is required to cancel it
+	CancelToken string `json:"-" bson:"cancel_token,omitempty"`
+
+	Status            JobStatus `json:"status" bson:"status"`
+	JobProgress       `bson:",inline"`
+	Error             string   `json:"error,omitempty" bson:"error,omitempty"`
+	TaskIDs           []string `json:"task_ids,omitempty" bson:"task_ids,omitempty"`
+	SkippedDuplicates int      `json:"skipped_duplicates" bson:"skipped_duplicates"`
+
+	// WorkerID is backend replica running the job, it has to update HeartbeatAt while job is running
+	WorkerID    string    `json:"-" bson:"worker_id,omitempty"`
+	Attempts    int       `json:"attempts" bson:"attempts"`
+	HeartbeatAt time.Time `json:"-" bson:"heartbeat_at,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	// ExpireAt is when finished job is removed by TTL index
+	ExpireAt *time.Time `json:"expire_at,omitempty" bson:"expire_at,omitempty"`
+}
+
+func (j Job) Finished() bool {
+	return j.Status == JobDone || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+type JobRepository interface {
+	CreateJob(source string, nickname string, last int, filter GameFilter, owner string) (Job, error)
+
+	// CreatePgnJob queues analysis of games uploaded as pgn text
+	CreatePgnJob(source string, pgn string, games int, owner string) (Job, error)
+
+	// GetJob returns empty job if it doesn't exist
+	GetJob(id string) (Job, error)
+
+	// ListJobs returns newest jobs of the owner first, empty status doesn't filter
+	ListJobs(owner string, status JobStatus, limit int64) ([]Job, error)
+
+	// CancelJob cancels queued or running job, false is returned if job is already finished
+	CancelJob(id primitive.ObjectID) (bool, error)
+
+	// ClaimNextJob atomically moves oldest queued job to running state, false is returned if queue is empty
+	ClaimNextJob(workerID string) (Job, bool, error)
+
+	// UpdateProgress also serves as heartbeat of running job,
+	// false is returned if job is no longer run by the worker (it was cancelled or taken over)
+	UpdateProgress(id primitive.ObjectID, workerID string, progress JobProgress) (bool, error)
+
+	// AddTaskIDs appends tasks found so far by running job
+	AddTaskIDs(id primitive.ObjectID, workerID string, taskIDs []string) error
+
+	FinishJob(id primitive.ObjectID, workerID string, taskIDs []string, skippedDuplicates int) error
+
+	FailJob(id primitive.ObjectID, workerID string, reason string) error
+
+	// ReleaseJob returns running job to the queue when its replica is shutting down,
+	// interrupted run isn't counted as an attempt
+	ReleaseJob(id primitive.ObjectID, workerID string) error
+
+	// RecoverStaleJobs requeues running jobs without heartbeat since staleBefore,
+	// jobs which already had maxAttempts are failed instead
+	RecoverStaleJobs(staleBefore time.Time, maxAttempts int) (int, error)
+}
+
+type jobRepository struct {
+	dbClient  *db.TaskDbClient
+	retention time.Duration
+}
+
+// NewJobRepository keeps finished jobs for retention period
+func NewJobRepository(dbClient *db.TaskDbClient, retention time.Duration) JobRepository {
+	return &jobRepository{dbClient, retention}
+}
+
+// finishedFields are set for every job leaving queue
+func (j *jobRepository) finishedFields(status JobStatus) bson.D {
+	now := time.Now()
+	return bson.D{
+		{"status", status},
+		{"finished_at", now},
+		{"expire_at", now.Add(j.retention)},
+	}
+}
+
+// requeuedFields reset progress of job returned to the queue, so next run starts from scratch
+func requeuedFields() bson.D {
+	return bson.D{
+		{"status", JobQueued},
+		{"progress", 0},
+		{"games_fetched", 0},
+		{"games_analyzed", 0},
+		{"puzzles_found", 0},
+	}
+}
+
+func (j *jobRepository) CreateJob(source string, nickname string, last int, filter GameFilter, owner string) (Job, error) {
+	job := Job{
+		Source:   source,
+		Nickname: nickname,
+		Last:     last,
+		Owner:    owner,
+	}
+	if !filter.IsEmpty() {
+		job.Filter = &filter
+	}
+	return j.insertJob(job)
+}
+
+func (j *jobRepository) CreatePgnJob(source string, pgn string, games int, owner string) (Job, error) {
+	return j.insertJob(Job{
+		Source: source,
+		Last:   games,
+		PGN:    pgn,
+		Owner:  owner,
+	})
+}
+
+func (j *jobRepository) insertJob(job Job) (Job, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	job.ID = primitive.NewObjectID()
+	if job.Owner == "" {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return Job{}, err
+		}
+		job.CancelToken = hex.EncodeToString(token)
+	}
+	job.Status = JobQueued
+	job.CreatedAt = time.Now()
+	if _, err := j.dbClient.JobCollection.InsertOne(ctx, job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// withoutPGN skips uploaded games which are only needed by worker running the job
+var withoutPGN = bson.D{{"pgn", 0}}
+
+func (j *jobRepository) GetJob(id string) (Job, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Job{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	cur := j.dbClient.JobCollection.FindOne(ctx, bson.D{{"_id", objectID}},
+		options.FindOne().SetProjection(withoutPGN),
+	)
+	var job Job
+	if err := cur.Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (j *jobRepository) ListJobs(owner string, status JobStatus, limit int64) ([]Job, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	filter := bson.D{{"owner", owner}}
+	if status != "" {
+		filter = append(filter, bson.E{"status", status})
+	}
+	cursor, err := j.dbClient.JobCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{"created_at", -1}}).SetLimit(limit).SetProjection(withoutPGN),
+	)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]Job, 0)
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (j *jobRepository) CancelJob(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	res, err := j.dbClient.JobCollection.UpdateOne(ctx,
+		bson.D{{"_id", id}, {"status", bson.D{{"$in", bson.A{JobQueued, JobRunning}}}}},
+		bson.D{{"$set", j.finishedFields(JobCancelled)}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+func (j *jobRepository) ClaimNextJob(workerID string) (Job, bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	now := time.Now()
+	cur := j.dbClient.JobCollection.FindOneAndUpdate(ctx,
+		bson.D{{"status", JobQueued}},
+		bson.D{
+			{"$set", bson.D{
+				{"status", JobRunning},
+				{"worker_id", workerID},
+				{"heartbeat_at", now},
+				{"started_at", now},
+				{"progress", 0},
+				{"task_ids", bson.A{}},
+			}},
+			{"$inc", bson.D{{"attempts", 1}}},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{"created_at", 1}}).
+			SetReturnDocument(options.After),
+	)
+	var job Job
+	if err := cur.Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Job{}, false, nil
+		}
+		return Job{}, false, err
+	}
+	return job, true, nil
+}
+
+// runningJobFilter makes sure that replica doesn't overwrite job which was already taken over by another one
+func runningJobFilter(id primitive.ObjectID, workerID string) bson.D {
+	return bson.D{{"_id", id}, {"status", JobRunning}, {"worker_id", workerID}}
+}
+
+func (j *jobRepository) UpdateProgress(id primitive.ObjectID, workerID string, progress JobProgress) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	res, err := j.dbClient.JobCollection.UpdateOne(ctx,
+		runningJobFilter(id, workerID),
+		bson.D{{"$set", bson.D{
+			{"progress", progress.Progress},
+			{"games_fetched", progress.GamesFetched},
+			{"games_analyzed", progress.GamesAnalyzed},
+			{"puzzles_found", progress.PuzzlesFound},
+			{"heartbeat_at", time.Now()},
+		}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (j *jobRepository) AddTaskIDs(id primitive.ObjectID, workerID string, taskIDs []string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	_, err := j.dbClient.JobCollection.UpdateOne(ctx,
+		runningJobFilter(id, workerID),
+		bson.D{{"$push", bson.D{{"task_ids", bson.D{{"$each", taskIDs}}}}}},
+	)
+	return err
+}
+
+func (j *jobRepository) FinishJob(id primitive.ObjectID, workerID string, taskIDs []string, skippedDuplicates int) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	_, err := j.dbClient.JobCollection.UpdateOne(ctx,
+		runningJobFilter(id, workerID),
+		bson.D{{"$set", append(j.finishedFields(JobDone),
+			bson.E{"progress", 1},
+			bson.E{"task_ids", taskIDs},
+			bson.E{"skipped_duplicates", skippedDuplicates},
+		)}},
+	)
+	return err
+}
+
+func (j *jobRepository) FailJob(id primitive.ObjectID, workerID string, reason string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	_, err := j.dbClient.JobCollection.UpdateOne(ctx,
+		runningJobFilter(id, workerID),
+		bson.D{{"$set", append(j.finishedFields(JobFailed), bson.E{"error", reason})}},
+	)
+	return err
+}
+
+func (j *jobRepository) ReleaseJob(id primitive.ObjectID, workerID string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	_, err := j.dbClient.JobCollection.UpdateOne(ctx,
+		runningJobFilter(id, workerID),
+		bson.D{
+			{"$set", requeuedFields()},
+			{"$unset", bson.D{{"worker_id", ""}, {"heartbeat_at", ""}, {"task_ids", ""}}},
+			{"$inc", bson.D{{"attempts", -1}}},
+		},
+	)
+	return err
+}
+
+func (j *jobRepository) RecoverStaleJobs(staleBefore time.Time, maxAttempts int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	stale := bson.D{{"status", JobRunning}, {"heartbeat_at", bson.D{{"$lt", staleBefore}}}}
+	failed, err := j.dbClient.JobCollection.UpdateMany(ctx,
+		append(stale, bson.E{"attempts", bson.D{{"$gte", maxAttempts}}}),
+		bson.D{{"$set", append(j.finishedFields(JobFailed), bson.E{"error", "job was interrupted too many times"})}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	requeued, err := j.dbClient.JobCollection.UpdateMany(ctx,
+		append(stale, bson.E{"attempts", bson.D{{"$lt", maxAttempts}}}),
+		bson.D{
+			{"$set", requeuedFields()},
+			{"$unset", bson.D{{"worker_id", ""}, {"heartbeat_at", ""}, {"task_ids", ""}}},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(failed.ModifiedCount + requeued.ModifiedCount), nil
+}
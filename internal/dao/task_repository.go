@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
 	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -14,19 +15,39 @@ import (
 )
 
 type TaskRepository interface {
-	GetRandomTaskForElo(elo int) (puzgen.Task, error)
+	GetTaskByID(id string) (puzgen.Task, error)
 
-	InsertTask(task puzgen.Task) error
+	GetRandomTaskForElo(elo int, generator puzgen.Generator, theme puzgen.Theme) (puzgen.Task, error)
 
-	InsertAllTasks(tasks []puzgen.Task) error
+	// UpdateTaskRating sets rating only if it is still equal to old one (nil for tasks without rating yet),
+	// returns false if rating was changed concurrently
+	UpdateTaskRating(id string, old *rating.Rating, r rating.Rating) (bool, error)
 
-	GetFirstUserTask(username string) (puzgen.Task, error)
+	// GetTasksByIDs keeps order of ids and skips tasks which don't exist
+	GetTasksByIDs(ids []string) ([]puzgen.Task, error)
 
-	GetLastUserTask(username string) (puzgen.Task, error)
+	// InsertTask saves task unless task with same position exists and reports whether it was inserted
+	InsertTask(task puzgen.Task) (bool, error)
 
-	GetLastUserTasks(username string, n int64) ([]puzgen.Task, int, error)
+	// InsertAllTasks saves tasks skipping already existing positions,
+	// returns saved tasks (existing ones for duplicates) and number of skipped duplicates
+	InsertAllTasks(tasks []puzgen.Task) ([]puzgen.Task, int, error)
 
-	GetUserTasksBetweenDates(username string, startTime primitive.DateTime, endTime primitive.DateTime) ([]puzgen.Task, error)
+	GetFirstUserTask(source string, username string) (puzgen.Task, error)
+
+	GetLastUserTask(source string, username string) (puzgen.Task, error)
+
+	GetLastUserTasks(source string, username string, n int64) ([]puzgen.Task, int, error)
+
+	GetUserTasksBetweenDates(source string, username string, startTime primitive.DateTime, endTime primitive.DateTime) ([]puzgen.Task, error)
+
+	// BackfillNormalizedFEN sets normalized position of tasks saved before deduplication,
+	// tasks repeating already saved positions are merged into them, numbers of updated and merged tasks are returned
+	BackfillNormalizedFEN() (int, int, error)
+
+	// BackfillRatings starts ratings of tasks saved before ratings were introduced from their target elo,
+	// returns number of updated tasks
+	BackfillRatings() (int, error)
 }
 
 const batchSize = 20
@@ -39,13 +60,27 @@ func NewTaskRepository(dbClient *db.TaskDbClient) TaskRepository {
 	return &taskRepository{dbClient}
 }
 
-func (t *taskRepository) GetRandomTaskForElo(elo int) (puzgen.Task, error) {
+func (t *taskRepository) GetRandomTaskForElo(elo int, generator puzgen.Generator, theme puzgen.Theme) (puzgen.Task, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
 	defer cancel()
 
-	matchStage := bson.D{{"$match", bson.D{{
-		"target_elo", bson.D{{"$gte", elo - 100}, {"$lte", elo + 100}},
-	}}}}
+	// tasks saved before ratings were introduced get rating from target elo by BackfillRatings
+	match := bson.D{
+		{"rating.rating", bson.D{{"$gte", elo - 100}, {"$lte", elo + 100}}},
+		{"validation.ambiguous", bson.D{{"$ne", true}}},
+	}
+	switch generator {
+	case "":
+	case puzgen.CheckmateGenerator:
+		// tasks generated before generator field was introduced are all checkmates
+		match = append(match, bson.E{"generator", bson.D{{"$in", bson.A{generator, nil}}}})
+	default:
+		match = append(match, bson.E{"generator", generator})
+	}
+	if theme != "" {
+		match = append(match, bson.E{"themes", theme})
+	}
+	matchStage := bson.D{{"$match", match}}
 	sampleStage := bson.D{{"$sample", bson.D{{"size", 1}}}}
 
 	cursor, err := t.dbClient.TaskCollection.Aggregate(ctx, mongo.Pipeline{matchStage, sampleStage})
@@ -63,44 +98,424 @@ func (t *taskRepository) GetRandomTaskForElo(elo int) (puzgen.Task, error) {
 	return loadedTasks[0], nil
 }
 
-func (t *taskRepository) InsertTask(task puzgen.Task) error {
+// idFilter matches both derived task ids and ObjectIDs of tasks saved before ids were introduced
+func idFilter(id string) bson.D {
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.D{{"_id", objectID}}
+	}
+	return bson.D{{"_id", id}}
+}
+
+func (t *taskRepository) GetTaskByID(id string) (puzgen.Task, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
 	defer cancel()
 
-	_, err := t.dbClient.TaskCollection.InsertOne(ctx, task)
-	return err
+	cur := t.dbClient.TaskCollection.FindOne(ctx, idFilter(id))
+	var task puzgen.Task
+	if err := cur.Decode(&task); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return puzgen.Task{}, nil
+		}
+		return puzgen.Task{}, err
+	}
+	return task, nil
+}
+
+func (t *taskRepository) GetTasksByIDs(ids []string) ([]puzgen.Task, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+
+	filters := make(bson.A, len(ids))
+	for i, id := range ids {
+		filters[i] = idFilter(id)
+	}
+	if len(filters) == 0 {
+		return []puzgen.Task{}, nil
+	}
+	cursor, err := t.dbClient.TaskCollection.Find(ctx, bson.D{{"$or", filters}})
+	if err != nil {
+		return nil, err
+	}
+	var loadedTasks []puzgen.Task
+	if err = cursor.All(ctx, &loadedTasks); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]puzgen.Task, len(loadedTasks))
+	for _, task := range loadedTasks {
+		byID[task.ID] = task
+	}
+	tasks := make([]puzgen.Task, 0, len(ids))
+	for _, id := range ids {
+		if task, ok := byID[id]; ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (t *taskRepository) UpdateTaskRating(id string, old *rating.Rating, r rating.Rating) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	filter := idFilter(id)
+	if old == nil {
+		filter = append(filter, bson.E{"rating", bson.D{{"$exists", false}}})
+	} else {
+		filter = append(filter, ratingFilter("rating", *old)...)
+	}
+	res, err := t.dbClient.TaskCollection.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{{"rating", r}}}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
 }
 
-func (t *taskRepository) InsertAllTasks(tasks []puzgen.Task) error {
+// ratingFilter matches rating stored in field by each of its components
+func ratingFilter(field string, r rating.Rating) bson.D {
+	return bson.D{
+		{field + ".rating", r.Rating},
+		{field + ".deviation", r.Deviation},
+		{field + ".volatility", r.Volatility},
+	}
+}
+
+func (t *taskRepository) BackfillRatings() (int, error) {
+	ctx := context.TODO()
+	withoutRating := bson.D{{"rating", bson.D{{"$exists", false}}}}
+	cur, err := t.dbClient.TaskCollection.Find(ctx, withoutRating, options.Find().SetProjection(bson.D{{"target_elo", 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	updated := 0
+	models := make([]mongo.WriteModel, 0, batchSize)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		// rating could be set by attempt in the meantime, then it is kept
+		res, err := t.dbClient.TaskCollection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += int(res.ModifiedCount)
+		models = models[:0]
+		return nil
+	}
+	for cur.Next(ctx) {
+		var task struct {
+			ID        interface{} `bson:"_id"`
+			TargetELO int         `bson:"target_elo"`
+		}
+		if err := cur.Decode(&task); err != nil {
+			return updated, err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(append(bson.D{{"_id", task.ID}}, withoutRating...)).
+			SetUpdate(bson.D{{"$set", bson.D{{"rating", rating.New(float64(task.TargetELO))}}}}))
+		if len(models) == batchSize {
+			if err := flush(); err != nil {
+				return updated, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return updated, err
+	}
+	return updated, flush()
+}
+
+// upsertModel inserts task if there is no task with same normalized position yet and remembers its game as another source otherwise
+func upsertModel(task puzgen.Task) *mongo.UpdateOneModel {
+	task.NormalizedFEN = puzgen.NormalizeFEN(task.StartFEN)
+	task.Sources = nil
+	if task.Rating == nil {
+		r := rating.New(float64(task.TargetELO))
+		task.Rating = &r
+	}
+	return mongo.NewUpdateOneModel().
+		SetFilter(bson.D{{"normalized_fen", task.NormalizedFEN}}).
+		SetUpdate(bson.D{
+			{"$setOnInsert", task},
+			{"$addToSet", bson.D{{"sources", task.GameData}}},
+		}).
+		SetUpsert(true)
+}
+
+func (t *taskRepository) InsertTask(task puzgen.Task) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	model := upsertModel(task)
+	res, err := t.dbClient.TaskCollection.UpdateOne(ctx, model.Filter, model.Update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// position was inserted concurrently, so upsert matches it now
+		res, err = t.dbClient.TaskCollection.UpdateOne(ctx, model.Filter, model.Update, options.Update().SetUpsert(true))
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount == 1, nil
+}
+
+// maxDuplicateRetries limits retries of upserts racing with concurrent inserts of the same positions
+const maxDuplicateRetries = 3
+
+// upsertBatch runs upserts in order and reports which of them inserted new task,
+// upsert racing with concurrent insert of the same position fails with duplicate key error
+// and is retried since the position is saved then
+func (t *taskRepository) upsertBatch(ctx context.Context, models []mongo.WriteModel) ([]bool, error) {
+	inserted := make([]bool, len(models))
+	start := 0
+	for retries := 0; ; retries++ {
+		res, err := t.dbClient.TaskCollection.BulkWrite(ctx, models[start:])
+		if res != nil {
+			for ind := range res.UpsertedIDs {
+				inserted[start+int(ind)] = true
+			}
+		}
+		if err == nil {
+			return inserted, nil
+		}
+		bulkErr, ok := err.(mongo.BulkWriteException)
+		if !ok || !mongo.IsDuplicateKeyError(err) || len(bulkErr.WriteErrors) == 0 || retries == maxDuplicateRetries {
+			return nil, err
+		}
+		// writes are ordered, so everything before failed upsert is already done
+		start += bulkErr.WriteErrors[0].Index
+	}
+}
+
+func (t *taskRepository) InsertAllTasks(tasks []puzgen.Task) ([]puzgen.Task, int, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Second)
 	defer cancel()
 
+	savedTasks := make([]puzgen.Task, len(tasks))
+	copy(savedTasks, tasks)
+	duplicates := make(map[string][]int)
+
 	for i := 0; i < len(tasks); i += batchSize {
 		sz := int(math.Min(float64(len(tasks)-i), float64(batchSize)))
-		toInsert := make([]interface{}, sz)
+		models := make([]mongo.WriteModel, sz)
+		for j := 0; j < sz; j++ {
+			models[j] = upsertModel(tasks[i+j])
+		}
+		inserted, err := t.upsertBatch(ctx, models)
+		if err != nil {
+			return nil, 0, err
+		}
 		for j := 0; j < sz; j++ {
-			toInsert[j] = tasks[i+j]
+			if !inserted[j] {
+				fen := puzgen.NormalizeFEN(tasks[i+j].StartFEN)
+				duplicates[fen] = append(duplicates[fen], i+j)
+			}
+		}
+	}
+
+	skipped := 0
+	for _, inds := range duplicates {
+		skipped += len(inds)
+	}
+	if skipped == 0 {
+		return savedTasks, 0, nil
+	}
+
+	// replace duplicates with already saved tasks, so their ids are valid
+	fens := make(bson.A, 0, len(duplicates))
+	for fen := range duplicates {
+		fens = append(fens, fen)
+	}
+	cur, err := t.dbClient.TaskCollection.Find(ctx, bson.D{{"normalized_fen", bson.D{{"$in", fens}}}})
+	if err != nil {
+		return nil, 0, err
+	}
+	var storedTasks []puzgen.Task
+	if err = cur.All(ctx, &storedTasks); err != nil {
+		return nil, 0, err
+	}
+	for _, stored := range storedTasks {
+		for _, ind := range duplicates[stored.NormalizedFEN] {
+			savedTasks[ind] = stored
+		}
+	}
+	return savedTasks, skipped, nil
+}
+
+// legacyTask is a task saved before deduplication, its _id is kept as is to match ObjectIDs exactly
+type legacyTask struct {
+	ID       interface{}       `bson:"_id"`
+	StartFEN string            `bson:"start_fen"`
+	GameData puzgen.GameData   `bson:"game_data"`
+	Sources  []puzgen.GameData `bson:"sources,omitempty"`
+}
+
+func (l legacyTask) stringID() string {
+	if objectID, ok := l.ID.(primitive.ObjectID); ok {
+		return objectID.Hex()
+	}
+	return fmt.Sprint(l.ID)
+}
+
+func (t *taskRepository) BackfillNormalizedFEN() (int, int, error) {
+	ctx := context.TODO()
+	cur, err := t.dbClient.TaskCollection.Find(ctx,
+		bson.D{{"normalized_fen", bson.D{{"$exists", false}}}},
+		options.Find().SetProjection(bson.D{{"start_fen", 1}, {"game_data", 1}, {"sources", 1}}),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(ctx)
+
+	updated, merged := 0, 0
+	for cur.Next(ctx) {
+		var task legacyTask
+		if err := cur.Decode(&task); err != nil {
+			return updated, merged, err
+		}
+		// sources are filled as well, so merged games don't hide the game task was found in
+		sources := task.Sources
+		if len(sources) == 0 {
+			sources = []puzgen.GameData{task.GameData}
+		}
+		fen := puzgen.NormalizeFEN(task.StartFEN)
+
+		_, err := t.dbClient.TaskCollection.UpdateOne(ctx,
+			bson.D{{"_id", task.ID}},
+			bson.D{{"$set", bson.D{{"normalized_fen", fen}, {"sources", sources}}}},
+		)
+		if err == nil {
+			updated++
+			continue
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return updated, merged, err
+		}
+		if err := t.mergeLegacyTask(ctx, task, fen, sources); err != nil {
+			return updated, merged, err
 		}
-		_, err := t.dbClient.TaskCollection.InsertMany(ctx, toInsert)
+		merged++
+	}
+	return updated, merged, cur.Err()
+}
+
+// mergeLegacyTask adds games of legacy task to saved task with the same position,
+// moves references of books and readers progress to it and removes legacy task
+func (t *taskRepository) mergeLegacyTask(ctx context.Context, task legacyTask, fen string, sources []puzgen.GameData) error {
+	var kept struct {
+		ID string `bson:"_id"`
+	}
+	err := t.dbClient.TaskCollection.FindOneAndUpdate(ctx,
+		bson.D{{"normalized_fen", fen}},
+		bson.D{{"$addToSet", bson.D{{"sources", bson.D{{"$each", sources}}}}}},
+	).Decode(&kept)
+	if err != nil {
+		return err
+	}
+
+	legacyID := task.stringID()
+	references := []struct {
+		collection *mongo.Collection
+		field      string
+	}{
+		{t.dbClient.BookCollection, "task_ids"},
+		{t.dbClient.BookProgressCollection, "solved"},
+		{t.dbClient.BookProgressCollection, "failed"},
+	}
+	for _, ref := range references {
+		_, err := ref.collection.UpdateMany(ctx,
+			bson.D{{ref.field, legacyID}},
+			bson.D{{"$set", bson.D{{ref.field + ".$", kept.ID}}}},
+		)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+
+	_, err = t.dbClient.TaskCollection.DeleteOne(ctx, bson.D{{"_id", task.ID}})
+	return err
 }
 
-func (t *taskRepository) GetLastUserTasks(username string, n int64) ([]puzgen.Task, int, error) {
+// userGameFilter matches game of user from source, fields of game are under prefix
+func userGameFilter(prefix string, source string, username string) bson.D {
+	var sourceFilter interface{} = source
+	if source == puzgen.DefaultGameSource {
+		// tasks saved before sources were introduced are from lichess
+		sourceFilter = bson.D{{"$in", bson.A{source, nil}}}
+	}
+	return bson.D{
+		{"$or", bson.A{
+			bson.D{{prefix + "white_player", username}},
+			bson.D{{prefix + "black_player", username}},
+		}},
+		{prefix + "source", sourceFilter},
+	}
+}
+
+// userFilter matches tasks found in any game of user, tasks saved before deduplication have no sources
+func userFilter(source string, username string) bson.D {
+	return bson.D{
+		{"$or", bson.A{
+			bson.D{{"sources", bson.D{{"$elemMatch", userGameFilter("", source, username)}}}},
+			append(bson.D{{"sources", bson.D{{"$exists", false}}}}, userGameFilter("game_data.", source, username)...),
+		}},
+	}
+}
+
+// userTasksPipeline returns task for every game of user it was found in with game_data replaced by that game,
+// so tasks deduplicated from games of other users are ordered by dates of user games
+func userTasksPipeline(source string, username string) mongo.Pipeline {
+	sourceExpr := bson.D{{"$ifNull", bson.A{"$$game.source", puzgen.DefaultGameSource}}}
+	return mongo.Pipeline{
+		{{"$match", userFilter(source, username)}},
+		{{"$addFields", bson.D{
+			{"user_games", bson.D{{"$filter", bson.D{
+				{"input", bson.D{{"$ifNull", bson.A{"$sources", bson.A{"$game_data"}}}}},
+				{"as", "game"},
+				{"cond", bson.D{{"$and", bson.A{
+					bson.D{{"$or", bson.A{
+						bson.D{{"$eq", bson.A{"$$game.white_player", username}}},
+						bson.D{{"$eq", bson.A{"$$game.black_player", username}}},
+					}}},
+					bson.D{{"$eq", bson.A{sourceExpr, source}}},
+				}}}},
+			}}}},
+		}}},
+		{{"$unwind", "$user_games"}},
+		{{"$addFields", bson.D{{"game_data", "$user_games"}}}},
+		{{"$project", bson.D{{"user_games", 0}}}},
+	}
+}
+
+// findUserTask returns first task of user in order of game dates, empty task is returned if user has no tasks
+func (t *taskRepository) findUserTask(source string, username string, order int) (puzgen.Task, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
 	defer cancel()
 
-	matchStage := bson.D{
-		{"$match", bson.D{
-			{"$or", bson.A{
-				bson.D{{"game_data.white_player", username}},
-				bson.D{{"game_data.black_player", username}},
-			}},
-		}},
+	pipeline := append(userTasksPipeline(source, username),
+		bson.D{{"$sort", bson.D{{"game_data.date", order}}}},
+		bson.D{{"$limit", 1}},
+	)
+	cur, err := t.dbClient.TaskCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return puzgen.Task{}, err
 	}
+	var tasks []puzgen.Task
+	if err := cur.All(ctx, &tasks); err != nil {
+		return puzgen.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return puzgen.Task{}, nil
+	}
+	return tasks[0], nil
+}
+
+func (t *taskRepository) GetLastUserTasks(source string, username string, n int64) ([]puzgen.Task, int, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
 	groupStage := bson.D{
 		{"$group", bson.D{
 			{"_id", "$game_data.date"},
@@ -143,7 +558,7 @@ func (t *taskRepository) GetLastUserTasks(username string, n int64) ([]puzgen.Ta
 			{"count", 1},
 		}},
 	}
-	cur, err := t.dbClient.TaskCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage, sortStage, limitStage, nullGroupStage, projectStage})
+	cur, err := t.dbClient.TaskCollection.Aggregate(ctx, append(userTasksPipeline(source, username), groupStage, sortStage, limitStage, nullGroupStage, projectStage))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -161,72 +576,28 @@ func (t *taskRepository) GetLastUserTasks(username string, n int64) ([]puzgen.Ta
 	return result[0].Result, result[0].Count, nil
 }
 
-func (t *taskRepository) GetLastUserTask(username string) (puzgen.Task, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
-	defer cancel()
-
-	opts := options.FindOne()
-	opts.SetSort(bson.D{{"game_data.date", -1}})
-
-	filter := bson.D{
-		{"$or", bson.A{
-			bson.D{{"game_data.white_player", username}},
-			bson.D{{"game_data.black_player", username}},
-		},
-		}}
-	cur := t.dbClient.TaskCollection.FindOne(ctx, filter, opts)
-	var task puzgen.Task
-	if err := cur.Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return puzgen.Task{}, nil
-		}
-		return puzgen.Task{}, err
-	}
-	return task, nil
+func (t *taskRepository) GetLastUserTask(source string, username string) (puzgen.Task, error) {
+	return t.findUserTask(source, username, -1)
 }
 
-func (t *taskRepository) GetFirstUserTask(username string) (puzgen.Task, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
-	defer cancel()
-
-	opts := options.FindOne()
-	opts.SetSort(bson.D{{"game_data.date", 1}})
-
-	filter := bson.D{
-		{"$or", bson.A{
-			bson.D{{"game_data.white_player", username}},
-			bson.D{{"game_data.black_player", username}},
-		},
-		}}
-	cur := t.dbClient.TaskCollection.FindOne(ctx, filter, opts)
-	var task puzgen.Task
-	if err := cur.Decode(&task); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return puzgen.Task{}, nil
-		}
-		return puzgen.Task{}, err
-	}
-	return task, nil
+func (t *taskRepository) GetFirstUserTask(source string, username string) (puzgen.Task, error) {
+	return t.findUserTask(source, username, 1)
 }
 
-func (t *taskRepository) GetUserTasksBetweenDates(username string, startTime primitive.DateTime, endTime primitive.DateTime) ([]puzgen.Task, error) {
+func (t *taskRepository) GetUserTasksBetweenDates(source string, username string, startTime primitive.DateTime, endTime primitive.DateTime) ([]puzgen.Task, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
 	defer cancel()
 
-	filter := bson.D{
-		{"$or", bson.A{
-			bson.D{{"game_data.white_player", username}},
-			bson.D{{"game_data.black_player", username}},
+	pipeline := append(userTasksPipeline(source, username), bson.D{
+		{"$match", bson.D{
+			{"game_data.date", bson.D{
+				{"$gte", startTime},
+				{"$lte", endTime},
+			}},
 		}},
-		{
-			"game_data.date", bson.D{
-			{"$gte", startTime},
-			{"$lte", endTime},
-		},
-		},
-	}
+	})
 
-	cur, err := t.dbClient.TaskCollection.Find(ctx, filter)
+	cur, err := t.dbClient.TaskCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
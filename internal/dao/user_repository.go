@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"context"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/db"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type User struct {
+	Username     string        `json:"username" bson:"username"`
+	PasswordHash string        `json:"-" bson:"password_hash"`
+	Rating       rating.Rating `json:"rating" bson:"rating"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+}
+
+type UserRepository interface {
+	// CreateUser returns false if username is already taken
+	CreateUser(user User) (bool, error)
+
+	// GetUser returns empty user if it doesn't exist
+	GetUser(username string) (User, error)
+
+	// GetUserRating returns default rating for unknown users
+	GetUserRating(username string) (rating.Rating, error)
+
+	// UpdateUserRating sets rating only if it is still equal to old one, returns false if rating was changed concurrently
+	UpdateUserRating(username string, old rating.Rating, r rating.Rating) (bool, error)
+}
+
+type userRepository struct {
+	dbClient *db.TaskDbClient
+}
+
+func NewUserRepository(dbClient *db.TaskDbClient) UserRepository {
+	return &userRepository{dbClient}
+}
+
+func (u *userRepository) CreateUser(user User) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	_, err := u.dbClient.UserCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (u *userRepository) GetUser(username string) (User, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	cur := u.dbClient.UserCollection.FindOne(ctx, bson.D{{"username", username}})
+	var user User
+	if err := cur.Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return User{}, nil
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (u *userRepository) GetUserRating(username string) (rating.Rating, error) {
+	user, err := u.GetUser(username)
+	if err != nil {
+		return rating.Rating{}, err
+	}
+	if user.Username == "" {
+		return rating.Default(), nil
+	}
+	return user.Rating, nil
+}
+
+func (u *userRepository) UpdateUserRating(username string, old rating.Rating, r rating.Rating) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	res, err := u.dbClient.UserCollection.UpdateOne(ctx,
+		append(bson.D{{"username", username}}, ratingFilter("rating", old)...),
+		bson.D{{"$set", bson.D{{"rating", r}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
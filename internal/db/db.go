@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -11,12 +12,69 @@ import (
 type TaskDbClient struct {
 	client         *mongo.Client
 	TaskCollection *mongo.Collection
+	UserCollection *mongo.Collection
+
+	BookCollection         *mongo.Collection
+	BookProgressCollection *mongo.Collection
+
+	JobCollection *mongo.Collection
 }
 
 func (r *TaskDbClient) Close() error {
 	return r.client.Disconnect(context.TODO())
 }
 
+// createTaskIndexes makes normalized position unique, tasks saved before deduplication don't have it until
+// backend backfills it on startup, so the index is partial,
+// players of source games are indexed to find tasks of user
+func createTaskIndexes(collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{"normalized_fen", 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{"normalized_fen", bson.D{{"$exists", true}}}}),
+		},
+		// random task is picked among tasks with close live rating
+		{Keys: bson.D{{"rating.rating", 1}}},
+		{Keys: bson.D{{"sources.white_player", 1}}},
+		{Keys: bson.D{{"sources.black_player", 1}}},
+	})
+	return err
+}
+
+func createUserIndexes(collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{"username", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func createBookIndexes(books *mongo.Collection, progress *mongo.Collection) error {
+	_, err := books.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{"owner", 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = progress.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{"book_id", 1}, {"username", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func createJobIndexes(collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{"status", 1}, {"created_at", 1}}},
+		{Keys: bson.D{{"owner", 1}, {"created_at", -1}}},
+		// finished jobs are removed when their retention period ends
+		{Keys: bson.D{{"expire_at", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
 func NewDbClientBackend(cfg *config.BackendConfiguration) (*TaskDbClient, error) {
 	clientOpts := options.Client().ApplyURI(cfg.Database.Address)
 
@@ -37,6 +95,37 @@ func NewDbClientBackend(cfg *config.BackendConfiguration) (*TaskDbClient, error)
 	if dbClient.TaskCollection == nil {
 		return nil, fmt.Errorf("Can't resolve collection %s", cfg.Database.DatabaseName+"."+cfg.Database.Collection)
 	}
+	if err = createTaskIndexes(dbClient.TaskCollection); err != nil {
+		return nil, err
+	}
+
+	dbClient.UserCollection = client.Database(cfg.Database.DatabaseName).Collection(cfg.Database.UserCollection)
+	if dbClient.UserCollection == nil {
+		return nil, fmt.Errorf("Can't resolve collection %s", cfg.Database.DatabaseName+"."+cfg.Database.UserCollection)
+	}
+	if err = createUserIndexes(dbClient.UserCollection); err != nil {
+		return nil, err
+	}
+
+	dbClient.BookCollection = client.Database(cfg.Database.DatabaseName).Collection(cfg.Database.BookCollection)
+	if dbClient.BookCollection == nil {
+		return nil, fmt.Errorf("Can't resolve collection %s", cfg.Database.DatabaseName+"."+cfg.Database.BookCollection)
+	}
+	dbClient.BookProgressCollection = client.Database(cfg.Database.DatabaseName).Collection(cfg.Database.BookProgressCollection)
+	if dbClient.BookProgressCollection == nil {
+		return nil, fmt.Errorf("Can't resolve collection %s", cfg.Database.DatabaseName+"."+cfg.Database.BookProgressCollection)
+	}
+	if err = createBookIndexes(dbClient.BookCollection, dbClient.BookProgressCollection); err != nil {
+		return nil, err
+	}
+
+	dbClient.JobCollection = client.Database(cfg.Database.DatabaseName).Collection(cfg.Database.JobCollection)
+	if dbClient.JobCollection == nil {
+		return nil, fmt.Errorf("Can't resolve collection %s", cfg.Database.DatabaseName+"."+cfg.Database.JobCollection)
+	}
+	if err = createJobIndexes(dbClient.JobCollection); err != nil {
+		return nil, err
+	}
 	return dbClient, nil
 }
 
@@ -60,5 +149,8 @@ func NewDbClientScraper(cfg *config.ScraperConfiguration) (*TaskDbClient, error)
 	if dbClient.TaskCollection == nil {
 		return nil, fmt.Errorf("Can't resolve collection %s", cfg.Database.DatabaseName+"."+cfg.Database.Collection)
 	}
+	if err = createTaskIndexes(dbClient.TaskCollection); err != nil {
+		return nil, err
+	}
 	return dbClient, nil
 }
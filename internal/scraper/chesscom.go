@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ChessComSource loads games from monthly archives of chess.com published data api
+type ChessComSource struct{}
+
+func (ChessComSource) Name() string {
+	return ChessComSourceName
+}
+
+type chessComArchives struct {
+	Archives []string `json:"archives"`
+}
+
+type chessComPlayer struct {
+	Username string `json:"username"`
+}
+
+type chessComGame struct {
+	URL   string `json:"url"`
+	PGN   string `json:"pgn"`
+	Rated bool   `json:"rated"`
+	// TimeClass is bullet, blitz, rapid or daily
+	TimeClass string `json:"time_class"`
+	// Rules is chess for standard games
+	Rules string         `json:"rules"`
+	White chessComPlayer `json:"white"`
+	Black chessComPlayer `json:"black"`
+}
+
+// chessComTimeClasses maps perf types which are named differently on chess.com
+var chessComTimeClasses = map[string]string{
+	"correspondence": "daily",
+}
+
+// matches checks filter fields other than dates, which are checked by game tags
+func (g chessComGame) matches(nickname string, filter dao.GameFilter) bool {
+	if filter.RatedOnly && !g.Rated {
+		return false
+	}
+	if filter.Variant != "" && g.Rules != "chess" {
+		return false
+	}
+	if len(filter.PerfTypes) > 0 {
+		found := false
+		for _, perf := range filter.PerfTypes {
+			timeClass, ok := chessComTimeClasses[perf]
+			if !ok {
+				timeClass = perf
+			}
+			found = found || timeClass == g.TimeClass
+		}
+		if !found {
+			return false
+		}
+	}
+
+	userIsWhite := strings.EqualFold(g.White.Username, nickname)
+	if filter.Color == "white" && !userIsWhite || filter.Color == "black" && userIsWhite {
+		return false
+	}
+	opponent := g.White
+	if userIsWhite {
+		opponent = g.Black
+	}
+	return filter.Opponent == "" || strings.EqualFold(opponent.Username, filter.Opponent)
+}
+
+func (s ChessComSource) UserGames(ctx context.Context, nickname string, max int, filter dao.GameFilter) ([]*pgn.Game, error) {
+	url := fmt.Sprintf("https://api.chess.com/pub/player/%s/games/archives", strings.ToLower(nickname))
+	resp, err := getSourceUrl(ctx, url, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, userNotFound{fmt.Errorf("user %s doesn't exist on chess.com", nickname)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chess.com responded with %s", resp.Status)
+	}
+	var archives chessComArchives
+	if err := json.NewDecoder(resp.Body).Decode(&archives); err != nil {
+		return nil, err
+	}
+
+	since, until := filter.Since, filter.Until
+	games := make([]*pgn.Game, 0)
+	// archives are listed from oldest month
+	for i := len(archives.Archives) - 1; i >= 0; i-- {
+		if max > 0 && len(games) >= max {
+			break
+		}
+		archive := archives.Archives[i]
+		month, err := archiveMonth(archive)
+		if err != nil {
+			return nil, err
+		}
+		if until != 0 && month.After(until.Time()) {
+			continue
+		}
+		if since != 0 && month.AddDate(0, 1, 0).Before(since.Time()) {
+			break
+		}
+
+		monthGames, err := s.archiveGames(ctx, archive)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(monthGames) - 1; j >= 0; j-- {
+			if max > 0 && len(games) >= max {
+				break
+			}
+			if !monthGames[j].matches(nickname, filter) {
+				continue
+			}
+			game, err := pgn.Parse(monthGames[j].PGN)
+			if err != nil {
+				log.Printf("skipping chess.com game %s: %v\n", monthGames[j].URL, err)
+				continue
+			}
+			t, ok := gameTime(game.Game)
+			if !ok {
+				continue
+			}
+			if until != 0 && t.After(until.Time()) || since != 0 && t.Before(since.Time()) {
+				continue
+			}
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
+
+// archiveMonth parses first moment of month from archive url ending with /{year}/{month}
+func archiveMonth(archive string) (time.Time, error) {
+	parts := strings.Split(strings.TrimSuffix(archive, "/"), "/")
+	if len(parts) < 2 {
+		return time.Time{}, fmt.Errorf("unexpected chess.com archive url %s", archive)
+	}
+	return time.Parse("2006/01", parts[len(parts)-2]+"/"+parts[len(parts)-1])
+}
+
+// archiveGames returns games of the month in order they were played
+func (s ChessComSource) archiveGames(ctx context.Context, archive string) ([]chessComGame, error) {
+	resp, err := getSourceUrl(ctx, archive, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chess.com responded with %s", resp.Status)
+	}
+	var month struct {
+		Games []chessComGame `json:"games"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&month); err != nil {
+		return nil, err
+	}
+	return month.Games, nil
+}
@@ -0,0 +1,91 @@
+package scraper
+
+import (
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"testing"
+	"time"
+)
+
+func TestArchiveMonth(t *testing.T) {
+	tests := []struct {
+		archive  string
+		expected time.Time
+		fails    bool
+	}{
+		{"https://api.chess.com/pub/player/hikaru/games/2021/05", time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), false},
+		{"https://api.chess.com/pub/player/hikaru/games/2020/12/", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC), false},
+		{"https://api.chess.com/pub/player/hikaru/games/archives", time.Time{}, true},
+		{"2021", time.Time{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.archive, func(t *testing.T) {
+			month, err := archiveMonth(test.archive)
+			if test.fails {
+				if err == nil {
+					t.Errorf("expected error, got %v", month)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !month.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, month)
+			}
+		})
+	}
+}
+
+func TestChessComGameMatches(t *testing.T) {
+	game := chessComGame{
+		Rated:     true,
+		TimeClass: "daily",
+		Rules:     "chess",
+		White:     chessComPlayer{Username: "Hikaru"},
+		Black:     chessComPlayer{Username: "MagnusCarlsen"},
+	}
+	casual := game
+	casual.Rated = false
+	chess960 := game
+	chess960.Rules = "chess960"
+
+	tests := []struct {
+		name     string
+		game     chessComGame
+		nickname string
+		filter   dao.GameFilter
+		expected bool
+	}{
+		{"empty filter", game, "hikaru", dao.GameFilter{}, true},
+		{"rated", game, "hikaru", dao.GameFilter{RatedOnly: true}, true},
+		{"casual", casual, "hikaru", dao.GameFilter{RatedOnly: true}, false},
+		{"standard variant", game, "hikaru", dao.GameFilter{Variant: "standard"}, true},
+		{"other variant", chess960, "hikaru", dao.GameFilter{Variant: "standard"}, false},
+		{"correspondence is daily", game, "hikaru", dao.GameFilter{PerfTypes: []string{"correspondence"}}, true},
+		{"one of perf types", game, "hikaru", dao.GameFilter{PerfTypes: []string{"blitz", "correspondence"}}, true},
+		{"other perf type", game, "hikaru", dao.GameFilter{PerfTypes: []string{"blitz", "rapid"}}, false},
+		{"daily isn't renamed", game, "hikaru", dao.GameFilter{PerfTypes: []string{"daily"}}, true},
+		{"user is white", game, "hikaru", dao.GameFilter{Color: "white"}, true},
+		{"user isn't black", game, "hikaru", dao.GameFilter{Color: "black"}, false},
+		{"user is black", game, "magnuscarlsen", dao.GameFilter{Color: "black"}, true},
+		{"user isn't white", game, "magnuscarlsen", dao.GameFilter{Color: "white"}, false},
+		{"opponent of white", game, "hikaru", dao.GameFilter{Opponent: "magnuscarlsen"}, true},
+		{"opponent of black", game, "MagnusCarlsen", dao.GameFilter{Opponent: "HIKARU"}, true},
+		{"user isn't own opponent", game, "hikaru", dao.GameFilter{Opponent: "hikaru"}, false},
+		{"other opponent", game, "hikaru", dao.GameFilter{Opponent: "firouzja2003"}, false},
+		{
+			"all fields",
+			game,
+			"magnuscarlsen",
+			dao.GameFilter{RatedOnly: true, Variant: "standard", PerfTypes: []string{"correspondence"}, Color: "black", Opponent: "hikaru"},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := test.game.matches(test.nickname, test.filter); matches != test.expected {
+				t.Errorf("expected %v for %+v, got %v", test.expected, test.filter, matches)
+			}
+		})
+	}
+}
@@ -1,9 +1,9 @@
 package scraper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/freeeve/uci"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
 	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
@@ -15,18 +15,20 @@ import (
 )
 
 type LiveLichessScraper struct {
-	taskRepo      dao.TaskRepository
-	curAnalyzer   *LiveGameAnalyzer
-	stockfishPath string
-	stockfishArgs []string
+	taskRepo         dao.TaskRepository
+	curAnalyzer      *LiveGameAnalyzer
+	stockfishPath    string
+	stockfishArgs    []string
+	generatorOptions puzgen.GeneratorOptions
 }
 
 func NewLiveLichessScraper(repository dao.TaskRepository, configuration config.ScraperConfiguration) *LiveLichessScraper {
 	return &LiveLichessScraper{
-		taskRepo:      repository,
-		curAnalyzer:   nil,
-		stockfishPath: configuration.Stockfish.Path,
-		stockfishArgs: configuration.Stockfish.Args,
+		taskRepo:         repository,
+		curAnalyzer:      nil,
+		stockfishPath:    configuration.Stockfish.Path,
+		stockfishArgs:    configuration.Stockfish.Args,
+		generatorOptions: configuration.GeneratorOptions(),
 	}
 }
 
@@ -132,24 +134,26 @@ func (l *LiveLichessScraper) Main() error {
 }
 
 func (l *LiveLichessScraper) NewLiveGameAnalyzer(tags []chess.TagPair) (*LiveGameAnalyzer, error) {
-	e, err := puzgen.SetupEngine(l.stockfishPath, l.stockfishArgs...)
+	e, err := puzgen.SetupEngine(l.stockfishPath, l.generatorOptions, l.stockfishArgs...)
 	if err != nil {
 		return nil, err
 	}
 	return &LiveGameAnalyzer{
-		tags:     tags,
-		engine:   e,
-		taskRepo: l.taskRepo,
+		tags:             tags,
+		engine:           e,
+		taskRepo:         l.taskRepo,
+		generatorOptions: l.generatorOptions,
 		// euristic size of chan (we assume we don't put 100 moves while analyzing 1 move)
 		GameChan: make(chan *chess.Game, 100),
 	}, nil
 }
 
 type LiveGameAnalyzer struct {
-	tags     []chess.TagPair
-	engine   *uci.Engine
-	taskRepo dao.TaskRepository
-	GameChan chan *chess.Game
+	tags             []chess.TagPair
+	engine           puzgen.Engine
+	taskRepo         dao.TaskRepository
+	generatorOptions puzgen.GeneratorOptions
+	GameChan         chan *chess.Game
 }
 
 func (l *LiveGameAnalyzer) StartAnalyze() {
@@ -162,7 +166,7 @@ func (l *LiveGameAnalyzer) Analyze() {
 		for _, tag := range l.tags {
 			game.AddTagPair(tag.Key, tag.Value)
 		}
-		task, err := puzgen.GenerateTaskFromPosition(*game, l.engine, watchedPositions)
+		task, err := puzgen.GenerateTaskFromPosition(context.Background(), *game, l.engine, watchedPositions, l.generatorOptions)
 		if err != nil {
 			log.Println(err.Error())
 			return
@@ -170,11 +174,15 @@ func (l *LiveGameAnalyzer) Analyze() {
 		if task.StartFEN == "" {
 			continue
 		}
+		task.GameData.Source = LichessSourceName
 		log.Printf("Generated task: %+v\n", task)
-		err = l.taskRepo.InsertTask(task)
+		inserted, err := l.taskRepo.InsertTask(task)
 		if err != nil {
 			log.Println(err.Error())
 			return
 		}
+		if !inserted {
+			log.Printf("Skipped duplicate task: %s\n", task.StartFEN)
+		}
 	}
 }
@@ -0,0 +1,198 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// JobQueue runs scraping jobs stored in mongo, replicas share the queue by claiming jobs atomically
+type JobQueue struct {
+	jobRepo  dao.JobRepository
+	factory  *LichessGameScraperFactory
+	workerID string
+
+	workers           int
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+	staleTimeout      time.Duration
+	recoverInterval   time.Duration
+	maxAttempts       int
+}
+
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "backend"
+	}
+	return fmt.Sprintf("%s-%d-%x", host, os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Uint32())
+}
+
+func NewJobQueue(cfg *config.BackendConfiguration, jobRepo dao.JobRepository, factory *LichessGameScraperFactory) *JobQueue {
+	return &JobQueue{
+		jobRepo:           jobRepo,
+		factory:           factory,
+		workerID:          workerID(),
+		workers:           cfg.Jobs.Workers,
+		pollInterval:      cfg.Jobs.PollInterval,
+		heartbeatInterval: cfg.Jobs.HeartbeatInterval,
+		staleTimeout:      cfg.Jobs.StaleTimeout,
+		recoverInterval:   cfg.Jobs.RecoverInterval,
+		maxAttempts:       cfg.Jobs.MaxAttempts,
+	}
+}
+
+// Run polls queue until ctx is cancelled, running jobs are then returned to the queue
+func (q *JobQueue) Run(ctx context.Context) {
+	log.Printf("job queue worker %s started with %d workers\n", q.workerID, q.workers)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.recoverStaleJobs(ctx)
+	}()
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.worker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// recoverStaleJobs returns jobs of replicas which stopped sending heartbeats to the queue,
+// it runs once per replica since stale jobs don't appear as often as queue is polled
+func (q *JobQueue) recoverStaleJobs(ctx context.Context) {
+	ticker := time.NewTicker(q.recoverInterval)
+	defer ticker.Stop()
+	for {
+		if recovered, err := q.jobRepo.RecoverStaleJobs(time.Now().Add(-q.staleTimeout), q.maxAttempts); err != nil {
+			log.Println(err)
+		} else if recovered > 0 {
+			log.Printf("recovered %d stale jobs\n", recovered)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *JobQueue) worker(ctx context.Context) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, ok, err := q.jobRepo.ClaimNextJob(q.workerID)
+		if err != nil {
+			log.Println(err)
+		} else if ok {
+			q.runJob(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *JobQueue) runJob(ctx context.Context, job dao.Job) {
+	log.Printf("running job %s for %s (attempt %d)\n", job.ID.Hex(), job.Nickname, job.Attempts)
+	var scraper *LichessGameScraper
+	var err error
+	if job.PGN != "" {
+		scraper, err = q.factory.CreatePgnScrapper(job.Source, job.PGN)
+	} else {
+		var filter dao.GameFilter
+		if job.Filter != nil {
+			filter = *job.Filter
+		}
+		scraper, err = q.factory.CreateLichessScrapper(job.Source, job.Nickname, job.Last, filter)
+	}
+	if err != nil {
+		if err := q.jobRepo.FailJob(job.ID, q.workerID, err.Error()); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	scraper.OnTasks = func(tasks []puzgen.Task) error {
+		taskIDs := make([]string, len(tasks))
+		for i, task := range tasks {
+			taskIDs[i] = task.ID
+		}
+		return q.jobRepo.AddTaskIDs(job.ID, q.workerID, taskIDs)
+	}
+
+	stopHeartbeat := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	interrupted := false
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(q.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ctx.Done():
+				// replica is shutting down, job is left to other replicas
+				interrupted = true
+				scraper.Cancel()
+				return
+			case <-ticker.C:
+				running, err := q.jobRepo.UpdateProgress(job.ID, q.workerID, scraper.ProgressDetails())
+				if err != nil {
+					log.Println(err)
+				} else if !running {
+					// job was cancelled through api, possibly on another replica
+					log.Printf("job %s is cancelled\n", job.ID.Hex())
+					scraper.Cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	scraper.Scrap()
+	close(stopHeartbeat)
+	<-heartbeatDone
+
+	switch scraper.Status() {
+	case dao.JobCancelled:
+		if interrupted {
+			log.Printf("returning job %s to the queue\n", job.ID.Hex())
+			if err := q.jobRepo.ReleaseJob(job.ID, q.workerID); err != nil {
+				log.Println(err)
+			}
+		}
+		return
+	case dao.JobFailed:
+		if err := q.jobRepo.FailJob(job.ID, q.workerID, scraper.Error().Error()); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	result := scraper.Result().(UserGamesResult)
+	taskIDs := make([]string, len(result.Tasks))
+	for i, task := range result.Tasks {
+		taskIDs[i] = task.ID
+	}
+	if err := q.jobRepo.FinishJob(job.ID, q.workerID, taskIDs, result.SkippedDuplicates); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,147 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/lichess"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/notnil/chess"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LichessSourceName  = puzgen.DefaultGameSource
+	ChessComSourceName = "chesscom"
+	// PgnSourceName is source of uploaded and imported games
+	PgnSourceName = "pgn"
+)
+
+// GameSource is a chess site games of users are scraped from
+type GameSource interface {
+	Name() string
+
+	// UserGames returns at most max games of user matching filter newest first,
+	// filter dates are inclusive, move annotations are kept if site provides them
+	UserGames(ctx context.Context, nickname string, max int, filter dao.GameFilter) ([]*pgn.Game, error)
+}
+
+// DefaultSources returns all supported sources by their names
+func DefaultSources() map[string]GameSource {
+	return map[string]GameSource{
+		LichessSourceName:  LichessSource{},
+		ChessComSourceName: ChessComSource{},
+	}
+}
+
+func IsKnownSource(name string) bool {
+	_, ok := DefaultSources()[name]
+	return ok
+}
+
+// gameTime returns start time of the game from its tags
+func gameTime(game *chess.Game) (time.Time, bool) {
+	dateTag, timeTag := game.GetTagPair("UTCDate"), game.GetTagPair("UTCTime")
+	if dateTag == nil || timeTag == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(puzgen.Layout+" "+puzgen.TimeLayout, dateTag.Value+" "+timeTag.Value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// getSourceUrl requests url with accept header if it isn't empty
+func getSourceUrl(ctx context.Context, url string, accept string) (*http.Response, error) {
+	log.Println(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	// chess.com rejects requests without user agent
+	req.Header.Set("User-Agent", "chess-puzzle-book-backend")
+	return http.DefaultClient.Do(req)
+}
+
+type LichessSource struct{}
+
+func (LichessSource) Name() string {
+	return LichessSourceName
+}
+
+// lichessStandardPerfTypes restrict export to standard games, other variants are separate perf types on lichess
+var lichessStandardPerfTypes = []string{"ultraBullet", "bullet", "blitz", "rapid", "classical", "correspondence"}
+
+func (s LichessSource) UserGames(ctx context.Context, nickname string, max int, filter dao.GameFilter) ([]*pgn.Game, error) {
+	params := url.Values{}
+	params.Set("max", strconv.Itoa(max))
+	params.Set("clocks", "true")
+	params.Set("evals", "true")
+	params.Set("opening", "true")
+	if filter.Since != 0 {
+		params.Set("since", strconv.FormatInt(int64(filter.Since), 10))
+	}
+	if filter.Until != 0 {
+		params.Set("until", strconv.FormatInt(int64(filter.Until), 10))
+	}
+	perfTypes := filter.PerfTypes
+	if len(perfTypes) == 0 && filter.Variant != "" {
+		perfTypes = lichessStandardPerfTypes
+	}
+	if len(perfTypes) > 0 {
+		params.Set("perfType", strings.Join(perfTypes, ","))
+	}
+	if filter.RatedOnly {
+		params.Set("rated", "true")
+	}
+	if filter.Color != "" {
+		params.Set("color", filter.Color)
+	}
+	if filter.Opponent != "" {
+		params.Set("vs", filter.Opponent)
+	}
+	exportUrl := fmt.Sprintf("https://lichess.org/api/games/user/%s?%s", url.PathEscape(nickname), params.Encode())
+	// ndjson export has game metadata and server analysis which let skip quiet positions
+	resp, err := getSourceUrl(ctx, exportUrl, "application/x-ndjson")
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, userNotFound{fmt.Errorf("user %s doesn't exist on lichess", nickname)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lichess responded with %s", resp.Status)
+	}
+
+	decoder := lichess.NewDecoder(resp.Body)
+	games := make([]*pgn.Game, 0)
+	for {
+		lichessGame, err := decoder.Next()
+		if err == io.EOF {
+			return games, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		game, err := lichessGame.PGN()
+		if err != nil {
+			// moves of some variants can't be replayed
+			log.Printf("skipping lichess game %s (%s): %v\n", lichessGame.ID, lichessGame.Variant, err)
+			continue
+		}
+		games = append(games, game)
+	}
+}
@@ -1,69 +1,141 @@
 package scraper
 
 import (
+	"context"
 	"fmt"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/config"
 	"github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
 	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
-	"github.com/notnil/chess"
 	"log"
-	"net/http"
+	"strings"
 	"sync"
 )
 
 type LichessGameScraperFactory struct {
-	StockfishPath string
-	StockfishArgs []string
-	TaskRepo      dao.TaskRepository
+	EnginePool       *puzgen.EnginePool
+	GeneratorOptions puzgen.GeneratorOptions
+	TaskRepo         dao.TaskRepository
+	// Sources are sites games can be scraped from by their names
+	Sources map[string]GameSource
 }
 
 func NewLichessGameScraperFactory(cfg *config.BackendConfiguration, taskRepo dao.TaskRepository) *LichessGameScraperFactory {
+	stockfishPath, stockfishArgs := cfg.Stockfish.Path, cfg.Stockfish.Args
+	opts := cfg.GeneratorOptions()
+	pool := puzgen.NewEnginePool(cfg.Stockfish.PoolSize, func() (puzgen.Engine, error) {
+		return puzgen.SetupEngine(stockfishPath, opts, stockfishArgs...)
+	})
 	return &LichessGameScraperFactory{
-		StockfishPath: cfg.Stockfish.Path,
-		StockfishArgs: cfg.Stockfish.Args,
-		TaskRepo:      taskRepo,
+		EnginePool:       pool,
+		GeneratorOptions: opts,
+		TaskRepo:         taskRepo,
+		Sources:          DefaultSources(),
 	}
 }
 
-func (f LichessGameScraperFactory) CreateLichessScrapper(nickname string, last int) LichessGameScraper {
-	return LichessGameScraper{
-		nickname:      nickname,
-		last:          last,
-		stockfishPath: f.StockfishPath,
-		stockfishArgs: f.StockfishArgs,
-		taskRepo:      f.TaskRepo,
-		done:          false,
+func (f *LichessGameScraperFactory) Close() {
+	f.EnginePool.Close()
+}
+
+// CreateLichessScrapper creates scraper of games on given source, empty source means lichess
+func (f LichessGameScraperFactory) CreateLichessScrapper(source string, nickname string, last int, filter dao.GameFilter) (*LichessGameScraper, error) {
+	if source == "" {
+		source = LichessSourceName
+	}
+	gameSource, ok := f.Sources[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown game source %s", source)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LichessGameScraper{
+		ctx:              ctx,
+		cancel:           cancel,
+		status:           dao.JobQueued,
+		source:           gameSource,
+		sourceName:       gameSource.Name(),
+		nickname:         nickname,
+		last:             last,
+		filter:           filter,
+		enginePool:       f.EnginePool,
+		generatorOptions: f.GeneratorOptions,
+		taskRepo:         f.TaskRepo,
+	}, nil
+}
+
+// CreatePgnScrapper creates scraper which analyzes uploaded games instead of fetching them,
+// tasks are saved with given source
+func (f LichessGameScraperFactory) CreatePgnScrapper(source string, text string) (*LichessGameScraper, error) {
+	games, err := pgn.ReadAll(strings.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing uploaded games: %v", err)
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LichessGameScraper{
+		ctx:              ctx,
+		cancel:           cancel,
+		status:           dao.JobQueued,
+		sourceName:       source,
+		uploaded:         games,
+		last:             len(games),
+		enginePool:       f.EnginePool,
+		generatorOptions: f.GeneratorOptions,
+		taskRepo:         f.TaskRepo,
+	}, nil
+}
+
+type UserGamesResult struct {
+	Tasks             []puzgen.Task `json:"tasks"`
+	SkippedDuplicates int           `json:"skipped_duplicates"`
 }
 
 type LichessGameScraper struct {
-	mu    sync.Mutex
-	tasks []puzgen.Task
-	err   error
-	done  bool
+	mu                sync.Mutex
+	tasks             []puzgen.Task
+	skippedDuplicates int
+	err               error
+	status            dao.JobStatus
+
+	ctx    context.Context
+	cancel context.CancelFunc
 
-	loadedTasks  bool
-	overallTasks int
-	doneTasks    int
+	loadedTasks   bool
+	overallTasks  int
+	doneTasks     int
+	gamesFetched  int
+	gamesAnalyzed int
+	puzzlesFound  int
 
-	nickname string
-	last     int
+	source     GameSource
+	sourceName string
+	nickname   string
+	last       int
+	filter     dao.GameFilter
+	// uploaded are games analyzed instead of games fetched from source
+	uploaded []*pgn.Game
 
-	taskRepo      dao.TaskRepository
-	stockfishPath string
-	stockfishArgs []string
+	taskRepo         dao.TaskRepository
+	enginePool       *puzgen.EnginePool
+	generatorOptions puzgen.GeneratorOptions
+
+	// OnTasks is called with saved tasks of every analyzed game, it can be called concurrently
+	OnTasks func(tasks []puzgen.Task) error
 }
 
-func (l *LichessGameScraper) Done() bool {
+func (l *LichessGameScraper) Status() dao.JobStatus {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.done
+	return l.status
+}
+
+func (l *LichessGameScraper) Cancel() {
+	l.cancel()
 }
 
 func (l *LichessGameScraper) Progress() float64 {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.done {
+	if l.status == dao.JobDone {
 		return 1
 	}
 	if !l.loadedTasks {
@@ -72,6 +144,18 @@ func (l *LichessGameScraper) Progress() float64 {
 	return 0.1 + 0.9*float64(l.doneTasks)/float64(l.overallTasks)
 }
 
+func (l *LichessGameScraper) ProgressDetails() dao.JobProgress {
+	progress := l.Progress()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return dao.JobProgress{
+		Progress:      progress,
+		GamesFetched:  l.gamesFetched,
+		GamesAnalyzed: l.gamesAnalyzed,
+		PuzzlesFound:  l.puzzlesFound,
+	}
+}
+
 func (l *LichessGameScraper) StartWork() {
 	go l.Scrap()
 }
@@ -79,7 +163,10 @@ func (l *LichessGameScraper) StartWork() {
 func (l *LichessGameScraper) Result() interface{} {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.tasks
+	return UserGamesResult{
+		Tasks:             append([]puzgen.Task{}, l.tasks...),
+		SkippedDuplicates: l.skippedDuplicates,
+	}
 }
 
 func (l *LichessGameScraper) Error() error {
@@ -88,35 +175,63 @@ func (l *LichessGameScraper) Error() error {
 	return l.err
 }
 
+// fail finishes work with user facing reason, errors caused by cancellation finish it as cancelled
+func (l *LichessGameScraper) fail(err error, reason error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		l.status = dao.JobCancelled
+		return
+	}
+	log.Println(err.Error())
+	l.err = reason
+	l.status = dao.JobFailed
+}
+
+func (l *LichessGameScraper) gamesFetchError(err error) error {
+	if _, ok := err.(userNotFound); ok {
+		return err
+	}
+	return fmt.Errorf("error fetching %s games", l.nickname)
+}
+
 func (l *LichessGameScraper) Scrap() {
-	lastTask, err := l.taskRepo.GetLastUserTask(l.nickname)
+	l.mu.Lock()
+	l.status = dao.JobRunning
+	l.mu.Unlock()
+
+	if l.uploaded != nil {
+		l.analyze(l.uploaded, 0, []puzgen.Task{})
+		return
+	}
+
+	// tasks saved before are of games not matching the filter, so filtered games are always fetched
+	if !l.filter.IsEmpty() {
+		games, err := l.source.UserGames(l.ctx, l.nickname, l.last, l.filter)
+		if err != nil {
+			l.fail(err, l.gamesFetchError(err))
+			return
+		}
+		l.analyze(games, 0, []puzgen.Task{})
+		return
+	}
+
+	sourceName := l.sourceName
+	lastTask, err := l.taskRepo.GetLastUserTask(sourceName, l.nickname)
 	if err != nil {
-		l.mu.Lock()
-		defer l.mu.Unlock()
-		log.Println(err.Error())
-		l.err = fmt.Errorf("error fetching last %s game", l.nickname)
-		l.done = true
+		l.fail(err, fmt.Errorf("error fetching last %s game", l.nickname))
 		return
 	}
 
-	url := fmt.Sprintf("https://lichess.org/api/games/user/%s?max=%d", l.nickname, l.last)
+	var newGames dao.GameFilter
 	if lastTask.StartFEN != "" {
 		// add one second offset
-		url += fmt.Sprintf("&since=%d", lastTask.GameData.Date+1000)
+		newGames.Since = lastTask.GameData.Date + 1000
 	}
-	log.Println(url)
 
-	games, err := l.GetGamesByUrl(url)
+	games, err := l.source.UserGames(l.ctx, l.nickname, l.last, newGames)
 	if err != nil {
-		l.mu.Lock()
-		defer l.mu.Unlock()
-		log.Println(err.Error())
-		l.done = true
-		if _, ok := err.(userNotFound); ok {
-			l.err = fmt.Errorf("user %s doesn't exist on lichess", l.nickname)
-		} else {
-			l.err = fmt.Errorf("error fetching %s games", l.nickname)
-		}
+		l.fail(err, l.gamesFetchError(err))
 		return
 	}
 
@@ -125,125 +240,99 @@ func (l *LichessGameScraper) Scrap() {
 	if lastTask.StartFEN == "" || l.last-len(games) == 0 {
 		doneTasks = []puzgen.Task{}
 	} else {
-		doneTasks, gamesInDb, err = l.taskRepo.GetLastUserTasks(l.nickname, int64(l.last-len(games)))
+		doneTasks, gamesInDb, err = l.taskRepo.GetLastUserTasks(sourceName, l.nickname, int64(l.last-len(games)))
 		if err != nil {
-			l.mu.Lock()
-			defer l.mu.Unlock()
-			l.done = true
-			log.Println(err.Error())
-			l.err = fmt.Errorf("error getting already parsed tasks")
+			l.fail(err, fmt.Errorf("error getting already parsed tasks"))
 			return
 		}
 	}
 
 	if len(games)+gamesInDb <= l.last {
-		firstTask, err := l.taskRepo.GetFirstUserTask(l.nickname)
+		firstTask, err := l.taskRepo.GetFirstUserTask(sourceName, l.nickname)
 		if err != nil {
-			l.mu.Lock()
-			defer l.mu.Unlock()
-			log.Println(err.Error())
-			l.err = fmt.Errorf("error fetching first %s game", l.nickname)
-			l.done = true
+			l.fail(err, fmt.Errorf("error fetching first %s game", l.nickname))
 			return
 		}
 		if firstTask.GameData != (puzgen.Task{}).GameData {
-			url = fmt.Sprintf("https://lichess.org/api/games/user/%s?max=%d&until=%d", l.nickname, l.last-(gamesInDb+len(games)), firstTask.GameData.Date-1000)
-			log.Println(url)
-			gamesBefore, err := l.GetGamesByUrl(url)
+			oldGames := dao.GameFilter{Until: firstTask.GameData.Date - 1000}
+			gamesBefore, err := l.source.UserGames(l.ctx, l.nickname, l.last-(gamesInDb+len(games)), oldGames)
 			if err != nil {
-				l.mu.Lock()
-				defer l.mu.Unlock()
-				log.Println(err.Error())
-				l.done = true
-				if _, ok := err.(userNotFound); ok {
-					l.err = fmt.Errorf("user %s doesn't exist on lichess", l.nickname)
-				} else {
-					l.err = fmt.Errorf("error fetching %s games", l.nickname)
-				}
+				l.fail(err, l.gamesFetchError(err))
 				return
 			}
 			games = append(games, gamesBefore...)
 		}
 	}
 
+	l.analyze(games, gamesInDb, doneTasks)
+}
+
+// analyze saves tasks of games, doneTasks of gamesInDb games analyzed before are added to the result
+func (l *LichessGameScraper) analyze(games []*pgn.Game, gamesInDb int, doneTasks []puzgen.Task) {
 	l.mu.Lock()
 	l.loadedTasks = true
 	l.overallTasks = l.last
 	l.doneTasks = gamesInDb
+	l.gamesFetched = len(games)
 	l.mu.Unlock()
 
-	progressChan := make(chan struct{}, l.overallTasks)
-	go func(l *LichessGameScraper, progressChan <-chan struct{}) {
-		for range progressChan {
-			l.mu.Lock()
-			l.doneTasks++
-			l.mu.Unlock()
+	// every game's tasks are saved as soon as it is analyzed, so they are available while work continues
+	savedTasks := make([][]puzgen.Task, len(games))
+	onGame := func(ind int, tasks []puzgen.Task) error {
+		skipped := 0
+		for i := range tasks {
+			tasks[i].GameData.Source = l.sourceName
+		}
+		if len(tasks) > 0 {
+			var err error
+			tasks, skipped, err = l.taskRepo.InsertAllTasks(tasks)
+			if err != nil {
+				return saveError{err}
+			}
+		}
+		if l.OnTasks != nil && len(tasks) > 0 {
+			if err := l.OnTasks(tasks); err != nil {
+				return saveError{err}
+			}
 		}
-	}(l, progressChan)
 
-	tasks, err := puzgen.AnalyzeAllGames(l.stockfishPath, games, progressChan, l.stockfishArgs...)
-	close(progressChan)
-	if err != nil {
 		l.mu.Lock()
 		defer l.mu.Unlock()
-		log.Println(err)
-		l.err = fmt.Errorf("error generating puzzles")
-		l.done = true
-		return
+		savedTasks[ind] = tasks
+		l.tasks = append(l.tasks, tasks...)
+		l.skippedDuplicates += skipped
+		l.doneTasks++
+		l.gamesAnalyzed++
+		l.puzzlesFound += len(tasks)
+		return nil
 	}
 
-	if len(tasks) > 0 {
-		err = l.taskRepo.InsertAllTasks(tasks)
-		if err != nil {
-			l.mu.Lock()
-			defer l.mu.Unlock()
-			log.Println(err.Error())
-			l.err = fmt.Errorf("error saving tasks to db")
-			l.done = true
-			return
+	_, err := puzgen.AnalyzeAllGames(l.ctx, l.enginePool, games, onGame, l.generatorOptions)
+	if err != nil {
+		if _, ok := err.(saveError); ok {
+			l.fail(err, fmt.Errorf("error saving tasks to db"))
+		} else {
+			l.fail(err, fmt.Errorf("error generating puzzles"))
 		}
+		return
 	}
 
+	// final result keeps games order
+	tasks := make([]puzgen.Task, 0)
+	for _, gameTasks := range savedTasks {
+		tasks = append(tasks, gameTasks...)
+	}
 	tasks = append(tasks, doneTasks...)
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.tasks = tasks
-	l.done = true
+	l.status = dao.JobDone
 }
 
-func (l *LichessGameScraper) GetGamesByUrl(url string) ([]*chess.Game, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, userNotFound{fmt.Errorf("user %s doesn't exist on lichess", l.nickname)}
-	}
-
-	scanner := chess.NewScanner(resp.Body)
-	buggedGames := make([]*chess.Game, 0)
-	for scanner.Scan() {
-		buggedGames = append(buggedGames, scanner.Next())
-	}
-	games := make([]*chess.Game, 0)
-	var tagGame *chess.Game
-	for i, game := range buggedGames {
-		if i%3 == 0 {
-			games = append(games, game)
-		} else if i%3 == 1 {
-			tagGame = game
-		} else {
-			for _, tagPair := range tagGame.TagPairs() {
-				game.AddTagPair(tagPair.Key, tagPair.Value)
-			}
-			games = append(games, game)
-		}
-	}
-	return games, nil
+type userNotFound struct {
+	error
 }
 
-type userNotFound struct {
+type saveError struct {
 	error
 }
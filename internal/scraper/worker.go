@@ -1,9 +1,17 @@
 package scraper
 
+import "github.com/gmkornilov/chess-puzzle-book-backend/internal/dao"
+
 type Worker interface {
 	StartWork()
+	// Cancel stops work, status becomes dao.JobCancelled
+	Cancel()
 	Result() interface{}
 	Progress() float64
-	Done() bool
+	// ProgressDetails reports progress with counters of fetched and analyzed games
+	ProgressDetails() dao.JobProgress
+	// Status uses same states as jobs in queue
+	Status() dao.JobStatus
+	// Error is set when status is dao.JobFailed
 	Error() error
 }
@@ -0,0 +1,156 @@
+package diagram
+
+import (
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/notnil/chess"
+	"math"
+)
+
+// Point is a point of a square with side 1, y axis goes down
+type Point struct {
+	X float64
+	Y float64
+}
+
+type Polygon []Point
+
+// Diagram is a board position oriented from the side of the solver
+type Diagram struct {
+	position *chess.Position
+	board    *chess.Board
+	Flipped  bool
+}
+
+func FromPosition(pos *chess.Position, flipped bool) *Diagram {
+	return &Diagram{
+		position: pos,
+		board:    pos.Board(),
+		Flipped:  flipped,
+	}
+}
+
+func FromFEN(fen string, flipped bool) (*Diagram, error) {
+	fenFunc, err := chess.FEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	return FromPosition(chess.NewGame(fenFunc).Position(), flipped), nil
+}
+
+// FromTask orients diagram by side to move
+func FromTask(task puzgen.Task) (*Diagram, error) {
+	return FromFEN(task.StartFEN, !task.IsWhiteTurn)
+}
+
+func (d *Diagram) Position() *chess.Position {
+	return d.position
+}
+
+// DecodeMove parses SAN move in diagram position, it is used to show solution moves
+func (d *Diagram) DecodeMove(san string) (*chess.Move, error) {
+	return chess.AlgebraicNotation{}.Decode(d.position, san)
+}
+
+// SquareAt returns square drawn in given column and row counting from top left corner
+func (d *Diagram) SquareAt(col int, row int) chess.Square {
+	if d.Flipped {
+		return chess.Square((row)*8 + 7 - col)
+	}
+	return chess.Square((7-row)*8 + col)
+}
+
+// Cell is reverse of SquareAt
+func (d *Diagram) Cell(sq chess.Square) (int, int) {
+	col, row := int(sq.File()), 7-int(sq.Rank())
+	if d.Flipped {
+		return 7 - col, 7 - row
+	}
+	return col, row
+}
+
+func (d *Diagram) Piece(col int, row int) chess.Piece {
+	return d.board.Piece(d.SquareAt(col, row))
+}
+
+func IsLightSquare(col int, row int) bool {
+	return (col+row)%2 == 0
+}
+
+// FileLabel and RankLabel return coordinates written along bottom and left sides
+func (d *Diagram) FileLabel(col int) string {
+	return d.SquareAt(col, 7).File().String()
+}
+
+func (d *Diagram) RankLabel(row int) string {
+	return d.SquareAt(0, row).Rank().String()
+}
+
+func rect(x0 float64, y0 float64, x1 float64, y1 float64) Polygon {
+	return Polygon{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+func circle(cx float64, cy float64, r float64) Polygon {
+	const segments = 16
+	res := make(Polygon, segments)
+	for i := range res {
+		angle := 2 * math.Pi * float64(i) / segments
+		res[i] = Point{cx + r*math.Cos(angle), cy + r*math.Sin(angle)}
+	}
+	return res
+}
+
+func scale(polygons []Polygon) []Polygon {
+	res := make([]Polygon, len(polygons))
+	for i, polygon := range polygons {
+		res[i] = make(Polygon, len(polygon))
+		for j, p := range polygon {
+			res[i][j] = Point{p.X / 100, p.Y / 100}
+		}
+	}
+	return res
+}
+
+// piece outlines are drawn in 100x100 box and painted in order
+var pieceShapes = map[chess.PieceType][]Polygon{
+	chess.Pawn: scale([]Polygon{
+		{{38, 48}, {62, 48}, {70, 82}, {30, 82}},
+		circle(50, 36, 13),
+		rect(24, 80, 76, 90),
+	}),
+	chess.Rook: scale([]Polygon{
+		rect(32, 38, 68, 82),
+		{{26, 16}, {36, 16}, {36, 24}, {45, 24}, {45, 16}, {55, 16}, {55, 24}, {64, 24}, {64, 16}, {74, 16}, {74, 38}, {26, 38}},
+		rect(22, 80, 78, 90),
+	}),
+	chess.Knight: scale([]Polygon{
+		{{30, 82}, {38, 58}, {30, 54}, {22, 48}, {24, 40}, {40, 24}, {42, 12}, {50, 20}, {62, 22}, {74, 40}, {74, 82}},
+		rect(22, 80, 78, 90),
+	}),
+	chess.Bishop: scale([]Polygon{
+		{{40, 62}, {60, 62}, {66, 82}, {34, 82}},
+		{{50, 22}, {60, 32}, {65, 44}, {62, 56}, {56, 64}, {44, 64}, {38, 56}, {35, 44}, {40, 32}},
+		circle(50, 17, 6),
+		rect(22, 80, 78, 90),
+	}),
+	chess.Queen: scale([]Polygon{
+		{{28, 70}, {18, 30}, {36, 50}, {42, 22}, {50, 48}, {58, 22}, {64, 50}, {82, 30}, {72, 70}},
+		circle(18, 28, 5),
+		circle(42, 19, 5),
+		circle(58, 19, 5),
+		circle(82, 28, 5),
+		{{28, 70}, {72, 70}, {76, 82}, {24, 82}},
+		rect(22, 80, 78, 90),
+	}),
+	chess.King: scale([]Polygon{
+		rect(46, 8, 54, 32),
+		rect(39, 14, 61, 22),
+		{{30, 70}, {22, 42}, {50, 32}, {78, 42}, {70, 70}},
+		{{30, 70}, {70, 70}, {74, 82}, {26, 82}},
+		rect(22, 80, 78, 90),
+	}),
+}
+
+// PieceShape returns polygons of the piece in unit square
+func PieceShape(pt chess.PieceType) []Polygon {
+	return pieceShapes[pt]
+}
@@ -0,0 +1,152 @@
+package diagram
+
+import (
+	"bytes"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"github.com/notnil/chess"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+const kingsFEN = "7k/8/8/8/8/8/8/K7 w - - 0 1"
+
+func TestSquareOrientation(t *testing.T) {
+	white, err := FromTask(puzgen.Task{StartFEN: kingsFEN, IsWhiteTurn: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	black, err := FromTask(puzgen.Task{StartFEN: kingsFEN, IsWhiteTurn: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if white.Flipped || !black.Flipped {
+		t.Fatalf("diagram should be flipped only for black solver")
+	}
+
+	tests := []struct {
+		d        *Diagram
+		col      int
+		row      int
+		expected chess.Square
+	}{
+		{white, 0, 0, chess.A8},
+		{white, 7, 7, chess.H1},
+		{white, 4, 6, chess.E2},
+		{black, 0, 0, chess.H1},
+		{black, 7, 7, chess.A8},
+		{black, 4, 6, chess.D7},
+	}
+	for _, test := range tests {
+		sq := test.d.SquareAt(test.col, test.row)
+		if sq != test.expected {
+			t.Errorf("flipped %v: expected %s at (%d, %d), got %s", test.d.Flipped, test.expected, test.col, test.row, sq)
+		}
+		if col, row := test.d.Cell(sq); col != test.col || row != test.row {
+			t.Errorf("flipped %v: expected %s in (%d, %d), got (%d, %d)", test.d.Flipped, sq, test.col, test.row, col, row)
+		}
+	}
+
+	if white.Piece(0, 7) != chess.WhiteKing || white.Piece(7, 0) != chess.BlackKing {
+		t.Errorf("unexpected pieces in corners of white diagram")
+	}
+	if black.Piece(7, 0) != chess.WhiteKing || black.Piece(0, 7) != chess.BlackKing {
+		t.Errorf("unexpected pieces in corners of black diagram")
+	}
+	if white.FileLabel(0) != "a" || white.RankLabel(0) != "8" || black.FileLabel(0) != "h" || black.RankLabel(0) != "1" {
+		t.Errorf("unexpected coordinate labels")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	d, err := FromFEN(kingsFEN, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := d.SVG(&buf, 80, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="80" height="80" viewBox="0 0 80 80">`) {
+		t.Errorf("unexpected svg header: %s", svg[:strings.Index(svg, "\n")])
+	}
+	if !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("svg is not closed")
+	}
+	if n := strings.Count(svg, "<rect "); n != 64 {
+		t.Errorf("expected 64 squares, got %d", n)
+	}
+	for _, square := range []string{
+		`<rect x="0" y="0" width="10" height="10" fill="#f0d9b5"/>`,
+		`<rect x="10" y="0" width="10" height="10" fill="#b58863"/>`,
+		`<rect x="70" y="70" width="10" height="10" fill="#f0d9b5"/>`,
+	} {
+		if !strings.Contains(svg, square) {
+			t.Errorf("expected square %s", square)
+		}
+	}
+
+	kingPolygons := len(PieceShape(chess.King))
+	if n := strings.Count(svg, `<polygon points="`); n != 2*kingPolygons {
+		t.Errorf("expected %d polygons of two kings, got %d", 2*kingPolygons, n)
+	}
+	if n := strings.Count(svg, `fill="#ffffff"`); n != kingPolygons {
+		t.Errorf("expected %d white piece polygons, got %d", kingPolygons, n)
+	}
+	if n := strings.Count(svg, `fill="#1e1e1e"`); n != kingPolygons {
+		t.Errorf("expected %d black piece polygons, got %d", kingPolygons, n)
+	}
+	if strings.Contains(svg, "<text") {
+		t.Errorf("coordinates shouldn't be drawn by default")
+	}
+
+	buf.Reset()
+	if err := d.SVG(&buf, 80, Options{Coordinates: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<text "); n != 16 {
+		t.Errorf("expected 16 coordinate labels, got %d", n)
+	}
+}
+
+func TestSolutionGIF(t *testing.T) {
+	task := puzgen.Task{
+		StartFEN:    "7k/8/8/8/8/8/1R6/R5K1 w - - 0 1",
+		IsWhiteTurn: true,
+		FirstPossibleTurns: []puzgen.Turn{{
+			SanNotation:           "Ra7",
+			AnswerTurnSanNotation: "Kg8",
+			ContinueVariations:    []puzgen.Turn{{SanNotation: "Rb8", IsLastTurn: true}},
+		}},
+	}
+	opts := DefaultAnimationOptions()
+
+	var buf bytes.Buffer
+	if err := SolutionGIF(&buf, task, false, 64, opts); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// start position and frame for every move of main line
+	if len(anim.Image) != 4 {
+		t.Fatalf("expected 4 frames, got %d", len(anim.Image))
+	}
+	expectedDelays := []int{150, 100, 100, 300}
+	for i, delay := range expectedDelays {
+		if anim.Delay[i] != delay {
+			t.Errorf("expected delay %d of frame %d, got %d", delay, i, anim.Delay[i])
+		}
+	}
+	if bounds := anim.Image[0].Bounds(); bounds.Dx() != 64 || bounds.Dy() != 64 {
+		t.Errorf("unexpected frame size %v", bounds)
+	}
+
+	task.FirstPossibleTurns[0].SanNotation = "Qd4"
+	if err := SolutionGIF(&buf, task, false, 64, opts); err == nil {
+		t.Error("expected error for illegal solution move")
+	}
+}
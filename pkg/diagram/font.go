@@ -0,0 +1,21 @@
+package diagram
+
+// glyphs of 3x5 bitmap font used to write coordinates on raster images, rows are top to bottom
+var glyphs = map[rune][5]string{
+	'a': {"...", "##.", "..#", "###", "###"},
+	'b': {"#..", "#..", "##.", "#.#", "##."},
+	'c': {"...", "...", ".##", "#..", ".##"},
+	'd': {"..#", "..#", ".##", "#.#", ".##"},
+	'e': {"...", ".#.", "###", "#..", ".##"},
+	'f': {".##", "#..", "##.", "#..", "#.."},
+	'g': {"...", ".##", "#.#", ".##", "##."},
+	'h': {"#..", "#..", "##.", "#.#", "#.#"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"##.", "..#", ".#.", "#..", "###"},
+	'3': {"##.", "..#", ".#.", "..#", "##."},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "##.", "..#", "##."},
+	'6': {".##", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+}
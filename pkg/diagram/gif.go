@@ -0,0 +1,93 @@
+package diagram
+
+import (
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+type AnimationOptions struct {
+	Options
+	// FirstDelay is how long start position is shown, MoveDelay is used for every move and LastDelay for final position
+	FirstDelay time.Duration
+	MoveDelay  time.Duration
+	LastDelay  time.Duration
+}
+
+func DefaultAnimationOptions() AnimationOptions {
+	return AnimationOptions{
+		Options:    Options{Coordinates: true},
+		FirstDelay: 1500 * time.Millisecond,
+		MoveDelay:  time.Second,
+		LastDelay:  3 * time.Second,
+	}
+}
+
+// gifPalette has all colors used in diagrams and their blends, so antialiased edges don't need dithering
+var gifPalette = func() color.Palette {
+	base := []color.RGBA{
+		LightSquareColor, DarkSquareColor, HighlightColor, ArrowColor,
+		WhitePieceColor, BlackPieceColor, OutlineColor,
+	}
+	const steps = 8
+	p := make(color.Palette, 0, 256)
+	for _, c := range base {
+		p = append(p, c)
+	}
+	for i := range base {
+		for j := i + 1; j < len(base); j++ {
+			for k := 1; k < steps; k++ {
+				t := float64(k) / steps
+				mix := func(a uint8, b uint8) uint8 {
+					return uint8(float64(a)*(1-t) + float64(b)*t + 0.5)
+				}
+				p = append(p, color.RGBA{mix(base[i].R, base[j].R), mix(base[i].G, base[j].G), mix(base[i].B, base[j].B), 255})
+			}
+		}
+	}
+	return p
+}()
+
+func centiseconds(d time.Duration) int {
+	return int(d / (10 * time.Millisecond))
+}
+
+// SolutionGIF plays main solution line of the task from its start position, every move is highlighted
+func SolutionGIF(w io.Writer, task puzgen.Task, flipped bool, size int, opts AnimationOptions) error {
+	d, err := FromFEN(task.StartFEN, flipped)
+	if err != nil {
+		return err
+	}
+
+	anim := &gif.GIF{}
+	addFrame := func(d *Diagram, frameOpts Options, delay time.Duration) {
+		frame := image.NewPaletted(image.Rect(0, 0, size, size), gifPalette)
+		draw.Draw(frame, frame.Rect, d.Image(size, frameOpts), image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, centiseconds(delay))
+	}
+
+	addFrame(d, opts.Options, opts.FirstDelay)
+	moves := puzgen.MainLine(task)
+	for i, san := range moves {
+		move, err := d.DecodeMove(san)
+		if err != nil {
+			return err
+		}
+		d = FromPosition(d.Position().Update(move), flipped)
+
+		frameOpts := opts.Options
+		frameOpts.Highlight = move
+		frameOpts.Arrow = nil
+		delay := opts.MoveDelay
+		if i == len(moves)-1 {
+			delay = opts.LastDelay
+		}
+		addFrame(d, frameOpts, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
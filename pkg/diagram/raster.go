@@ -0,0 +1,131 @@
+package diagram
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// subsamples per pixel side used for antialiasing
+const subsamples = 4
+
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func (r *rasterCanvas) blend(x int, y int, c color.Color, coverage float64) {
+	if !(image.Point{x, y}.In(r.img.Rect)) || coverage <= 0 {
+		return
+	}
+	cr, cg, cb, _ := c.RGBA()
+	old := r.img.RGBAAt(x, y)
+	mix := func(dst uint8, src uint32) uint8 {
+		return uint8(float64(dst)*(1-coverage) + float64(src>>8)*coverage + 0.5)
+	}
+	r.img.SetRGBA(x, y, color.RGBA{mix(old.R, cr), mix(old.G, cg), mix(old.B, cb), 255})
+}
+
+func (r *rasterCanvas) Rect(x float64, y float64, w float64, h float64, fill color.Color) {
+	r.fill([]Point{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}, fill)
+}
+
+// fill paints polygon with even-odd rule, coverage of each pixel is estimated by subsampling
+func (r *rasterCanvas) fill(points []Point, c color.Color) {
+	if len(points) < 3 {
+		return
+	}
+	minX, minY, maxX, maxY := points[0].X, points[0].Y, points[0].X, points[0].Y
+	for _, p := range points {
+		minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+		maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+	}
+	bounds := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY))).
+		Intersect(r.img.Rect)
+
+	crossings := make([]float64, 0, len(points))
+	coverage := make([]int, bounds.Dx())
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for i := range coverage {
+			coverage[i] = 0
+		}
+		for sy := 0; sy < subsamples; sy++ {
+			y := float64(py) + (float64(sy)+0.5)/subsamples
+			crossings = crossings[:0]
+			for i := range points {
+				a, b := points[i], points[(i+1)%len(points)]
+				if (a.Y <= y) == (b.Y <= y) {
+					continue
+				}
+				crossings = append(crossings, a.X+(y-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+			}
+			for px := bounds.Min.X; px < bounds.Max.X; px++ {
+				for sx := 0; sx < subsamples; sx++ {
+					x := float64(px) + (float64(sx)+0.5)/subsamples
+					inside := false
+					for _, cross := range crossings {
+						if cross < x {
+							inside = !inside
+						}
+					}
+					if inside {
+						coverage[px-bounds.Min.X]++
+					}
+				}
+			}
+		}
+		for i, covered := range coverage {
+			r.blend(bounds.Min.X+i, py, c, float64(covered)/(subsamples*subsamples))
+		}
+	}
+}
+
+func (r *rasterCanvas) Polygon(points []Point, fill color.Color, stroke color.Color, strokeWidth float64) {
+	if fill != nil {
+		r.fill(points, fill)
+	}
+	if stroke == nil || strokeWidth <= 0 {
+		return
+	}
+	// outline is painted edge by edge as thin quads
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -(b.Y-a.Y)/length*strokeWidth/2, (b.X-a.X)/length*strokeWidth/2
+		r.fill([]Point{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}}, stroke)
+	}
+}
+
+func (r *rasterCanvas) Text(x float64, y float64, size float64, text string, fill color.Color) {
+	pixel := size / 5
+	width := float64(len(text)*4-1) * pixel
+	left, top := x-width/2, y-size/2
+	for i, ch := range text {
+		glyph, ok := glyphs[ch]
+		if !ok {
+			continue
+		}
+		for row, line := range glyph {
+			for col, bit := range line {
+				if bit == '#' {
+					r.Rect(left+float64(i*4+col)*pixel, top+float64(row)*pixel, pixel, pixel, fill)
+				}
+			}
+		}
+	}
+}
+
+// Image renders diagram to RGBA image with given side in pixels
+func (d *Diagram) Image(size int, opts Options) *image.RGBA {
+	c := &rasterCanvas{image.NewRGBA(image.Rect(0, 0, size, size))}
+	d.Draw(c, 0, 0, float64(size), opts)
+	return c.img
+}
+
+func (d *Diagram) PNG(w io.Writer, size int, opts Options) error {
+	return png.Encode(w, d.Image(size, opts))
+}
@@ -0,0 +1,133 @@
+package diagram
+
+import (
+	"github.com/notnil/chess"
+	"image/color"
+	"math"
+)
+
+var (
+	LightSquareColor = color.RGBA{240, 217, 181, 255}
+	DarkSquareColor  = color.RGBA{181, 136, 99, 255}
+	HighlightColor   = color.RGBA{205, 210, 106, 255}
+	ArrowColor       = color.RGBA{21, 120, 27, 255}
+	WhitePieceColor  = color.RGBA{255, 255, 255, 255}
+	BlackPieceColor  = color.RGBA{30, 30, 30, 255}
+	OutlineColor     = color.RGBA{0, 0, 0, 255}
+)
+
+// Canvas is implemented by every output format, coordinates have origin in top left corner and y axis going down
+type Canvas interface {
+	Rect(x float64, y float64, w float64, h float64, fill color.Color)
+	Polygon(points []Point, fill color.Color, stroke color.Color, strokeWidth float64)
+	// Text is centered at given point
+	Text(x float64, y float64, size float64, text string, fill color.Color)
+}
+
+type Options struct {
+	// Coordinates are written in the corners of edge squares
+	Coordinates bool
+	// Highlight colors start and end squares of the move
+	Highlight *chess.Move
+	// Arrow is drawn from start to end square of the move over pieces
+	Arrow *chess.Move
+}
+
+// Draw renders diagram into square with top left corner at (x, y)
+func (d *Diagram) Draw(c Canvas, x float64, y float64, size float64, opts Options) {
+	square := size / 8
+	highlighted := make(map[chess.Square]bool)
+	if opts.Highlight != nil {
+		highlighted[opts.Highlight.S1()] = true
+		highlighted[opts.Highlight.S2()] = true
+	}
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			sqX, sqY := x+float64(col)*square, y+float64(row)*square
+			var fill color.Color = DarkSquareColor
+			if highlighted[d.SquareAt(col, row)] {
+				fill = HighlightColor
+			} else if IsLightSquare(col, row) {
+				fill = LightSquareColor
+			}
+			c.Rect(sqX, sqY, square, square, fill)
+		}
+	}
+
+	if opts.Coordinates {
+		labelSize := square / 4.5
+		for i := 0; i < 8; i++ {
+			// labels take color of the opposite square so they stay readable
+			fileColor, rankColor := LightSquareColor, LightSquareColor
+			if IsLightSquare(i, 7) {
+				fileColor = DarkSquareColor
+			}
+			if IsLightSquare(0, i) {
+				rankColor = DarkSquareColor
+			}
+			c.Text(x+float64(i+1)*square-labelSize*0.6, y+size-labelSize*0.7, labelSize, d.FileLabel(i), fileColor)
+			c.Text(x+labelSize*0.6, y+float64(i)*square+labelSize*0.7, labelSize, d.RankLabel(i), rankColor)
+		}
+	}
+
+	strokeWidth := math.Max(square/40, 0.5)
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := d.Piece(col, row)
+			if piece == chess.NoPiece {
+				continue
+			}
+			var fill color.Color = WhitePieceColor
+			if piece.Color() == chess.Black {
+				fill = BlackPieceColor
+			}
+			sqX, sqY := x+float64(col)*square, y+float64(row)*square
+			for _, polygon := range PieceShape(piece.Type()) {
+				c.Polygon(place(polygon, sqX, sqY, square), fill, OutlineColor, strokeWidth)
+			}
+		}
+	}
+
+	if opts.Arrow != nil {
+		c.Polygon(place(d.arrow(opts.Arrow.S1(), opts.Arrow.S2()), x, y, square), ArrowColor, nil, 0)
+	}
+}
+
+func place(polygon Polygon, x float64, y float64, scale float64) []Point {
+	res := make([]Point, len(polygon))
+	for i, p := range polygon {
+		res[i] = Point{x + p.X*scale, y + p.Y*scale}
+	}
+	return res
+}
+
+// arrow returns arrow polygon between square centers measured in squares
+func (d *Diagram) arrow(from chess.Square, to chess.Square) Polygon {
+	const (
+		shaftWidth = 0.15
+		headWidth  = 0.45
+		headLength = 0.4
+	)
+	fromCol, fromRow := d.Cell(from)
+	toCol, toRow := d.Cell(to)
+	x0, y0 := float64(fromCol)+0.5, float64(fromRow)+0.5
+	x1, y1 := float64(toCol)+0.5, float64(toRow)+0.5
+	length := math.Hypot(x1-x0, y1-y0)
+	if length == 0 {
+		return nil
+	}
+	// unit vectors along and across the arrow
+	ux, uy := (x1-x0)/length, (y1-y0)/length
+	nx, ny := -uy, ux
+	bx, by := x1-ux*headLength, y1-uy*headLength
+	return Polygon{
+		{x0 + nx*shaftWidth/2, y0 + ny*shaftWidth/2},
+		{bx + nx*shaftWidth/2, by + ny*shaftWidth/2},
+		{bx + nx*headWidth/2, by + ny*headWidth/2},
+		{x1, y1},
+		{bx - nx*headWidth/2, by - ny*headWidth/2},
+		{bx - nx*shaftWidth/2, by - ny*shaftWidth/2},
+		{x0 - nx*shaftWidth/2, y0 - ny*shaftWidth/2},
+	}
+}
@@ -0,0 +1,58 @@
+package diagram
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func svgNum(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func svgColor(c color.Color) string {
+	if c == nil {
+		return "none"
+	}
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func (s *svgCanvas) Rect(x float64, y float64, w float64, h float64, fill color.Color) {
+	fmt.Fprintf(&s.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+		svgNum(x), svgNum(y), svgNum(w), svgNum(h), svgColor(fill))
+}
+
+func (s *svgCanvas) Polygon(points []Point, fill color.Color, stroke color.Color, strokeWidth float64) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%.2f,%.2f", p.X, p.Y)
+	}
+	fmt.Fprintf(&s.buf, `<polygon points="%s" fill="%s"`, strings.Join(coords, " "), svgColor(fill))
+	if stroke != nil {
+		fmt.Fprintf(&s.buf, ` stroke="%s" stroke-width="%s" stroke-linejoin="round"`, svgColor(stroke), svgNum(strokeWidth))
+	}
+	s.buf.WriteString("/>\n")
+}
+
+func (s *svgCanvas) Text(x float64, y float64, size float64, text string, fill color.Color) {
+	fmt.Fprintf(&s.buf, `<text x="%s" y="%s" font-family="sans-serif" font-size="%s" font-weight="bold" text-anchor="middle" dominant-baseline="central" fill="%s">%s</text>`+"\n",
+		svgNum(x), svgNum(y), svgNum(size), svgColor(fill), html.EscapeString(text))
+}
+
+// SVG writes diagram as standalone SVG image with given side in pixels
+func (d *Diagram) SVG(w io.Writer, size int, opts Options) error {
+	c := &svgCanvas{}
+	d.Draw(c, 0, 0, float64(size), opts)
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n%s</svg>\n",
+		size, size, size, size, c.buf.String())
+	return err
+}
@@ -0,0 +1,223 @@
+package lichess
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/notnil/chess"
+	"io"
+	"strings"
+	"time"
+)
+
+// Game is game of lichess games export in application/x-ndjson format
+type Game struct {
+	ID         string  `json:"id"`
+	Rated      bool    `json:"rated"`
+	Variant    string  `json:"variant"`
+	Speed      string  `json:"speed"`
+	Perf       string  `json:"perf"`
+	CreatedAt  int64   `json:"createdAt"`
+	LastMoveAt int64   `json:"lastMoveAt"`
+	Status     string  `json:"status"`
+	Players    Players `json:"players"`
+	// Winner is empty for draws and unfinished games
+	Winner     string   `json:"winner"`
+	InitialFEN string   `json:"initialFen"`
+	Opening    *Opening `json:"opening"`
+	// Moves are space separated moves in san
+	Moves string `json:"moves"`
+	// Clocks are remaining times in centiseconds after every ply, they are requested with clocks=true
+	Clocks []int  `json:"clocks"`
+	Clock  *Clock `json:"clock"`
+	// Analysis are server evaluations after every ply, they are requested with evals=true for analysed games
+	Analysis []Analysis `json:"analysis"`
+}
+
+type Players struct {
+	White Player `json:"white"`
+	Black Player `json:"black"`
+}
+
+type Player struct {
+	User *struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	} `json:"user"`
+	Rating int `json:"rating"`
+	// AILevel is set for games against lichess AI
+	AILevel int `json:"aiLevel"`
+}
+
+func (p Player) Name() string {
+	switch {
+	case p.User != nil:
+		return p.User.Name
+	case p.AILevel > 0:
+		return fmt.Sprintf("lichess AI level %d", p.AILevel)
+	default:
+		return "Anonymous"
+	}
+}
+
+type Opening struct {
+	ECO  string `json:"eco"`
+	Name string `json:"name"`
+	Ply  int    `json:"ply"`
+}
+
+type Clock struct {
+	// Initial and Increment are in seconds
+	Initial   int `json:"initial"`
+	Increment int `json:"increment"`
+}
+
+// Analysis is evaluation of position from white side, Mate is set instead of Eval when mate is found
+type Analysis struct {
+	Eval     *int   `json:"eval"`
+	Mate     *int   `json:"mate"`
+	Best     string `json:"best"`
+	Judgment *struct {
+		Name    string `json:"name"`
+		Comment string `json:"comment"`
+	} `json:"judgment"`
+}
+
+// Decoder reads games of export stream one by one
+type Decoder struct {
+	dec *json.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{json.NewDecoder(r)}
+}
+
+// Next returns io.EOF after the last game
+func (d *Decoder) Next() (Game, error) {
+	var game Game
+	if err := d.dec.Decode(&game); err != nil {
+		return Game{}, err
+	}
+	return game, nil
+}
+
+func (g Game) Result() string {
+	switch {
+	case g.Winner == "white":
+		return "1-0"
+	case g.Winner == "black":
+		return "0-1"
+	case g.Status == "created" || g.Status == "started":
+		return "*"
+	default:
+		return "1/2-1/2"
+	}
+}
+
+// Tags returns tag pairs of the game like in lichess pgn export
+func (g Game) Tags() []*chess.TagPair {
+	rated := "Casual"
+	if g.Rated {
+		rated = "Rated"
+	}
+	created := time.Unix(0, g.CreatedAt*int64(time.Millisecond)).UTC()
+	tags := []*chess.TagPair{
+		{Key: "Event", Value: fmt.Sprintf("%s %s game", rated, g.Speed)},
+		{Key: "Site", Value: "https://lichess.org/" + g.ID},
+		{Key: "Date", Value: created.Format("2006.01.02")},
+		{Key: "White", Value: g.Players.White.Name()},
+		{Key: "Black", Value: g.Players.Black.Name()},
+		{Key: "Result", Value: g.Result()},
+		{Key: "UTCDate", Value: created.Format("2006.01.02")},
+		{Key: "UTCTime", Value: created.Format("15:04:05")},
+		{Key: "Variant", Value: variantName(g.Variant)},
+	}
+	if g.Players.White.Rating > 0 {
+		tags = append(tags, &chess.TagPair{Key: "WhiteElo", Value: fmt.Sprint(g.Players.White.Rating)})
+	}
+	if g.Players.Black.Rating > 0 {
+		tags = append(tags, &chess.TagPair{Key: "BlackElo", Value: fmt.Sprint(g.Players.Black.Rating)})
+	}
+	if g.Clock != nil {
+		tags = append(tags, &chess.TagPair{Key: "TimeControl", Value: fmt.Sprintf("%d+%d", g.Clock.Initial, g.Clock.Increment)})
+	}
+	if g.Opening != nil {
+		tags = append(tags,
+			&chess.TagPair{Key: "ECO", Value: g.Opening.ECO},
+			&chess.TagPair{Key: "Opening", Value: g.Opening.Name},
+		)
+	}
+	if g.InitialFEN != "" {
+		tags = append(tags,
+			&chess.TagPair{Key: "FEN", Value: g.InitialFEN},
+			&chess.TagPair{Key: "SetUp", Value: "1"},
+		)
+	}
+	return tags
+}
+
+// variantName converts variant key to name used in pgn tag
+func variantName(variant string) string {
+	switch variant {
+	case "", "standard":
+		return "Standard"
+	case "chess960":
+		return "Chess960"
+	case "fromPosition":
+		return "From Position"
+	case "kingOfTheHill":
+		return "King of the Hill"
+	case "threeCheck":
+		return "Three-check"
+	case "racingKings":
+		return "Racing Kings"
+	default:
+		return variant
+	}
+}
+
+// PGN replays moves of the game, clocks and server analysis are kept in annotations
+func (g Game) PGN() (*pgn.Game, error) {
+	options := []func(*chess.Game){chess.TagPairs(g.Tags())}
+	if g.InitialFEN != "" {
+		fen, err := chess.FEN(g.InitialFEN)
+		if err != nil {
+			return nil, err
+		}
+		options = append([]func(*chess.Game){fen}, options...)
+	}
+	game := chess.NewGame(options...)
+
+	moves := strings.Fields(g.Moves)
+	annotations := make([]pgn.Annotation, len(moves))
+	for i, san := range moves {
+		move, err := chess.AlgebraicNotation{}.Decode(game.Position(), san)
+		if err != nil {
+			return nil, fmt.Errorf("game %s: %v", g.ID, err)
+		}
+		if err := game.Move(move); err != nil {
+			return nil, fmt.Errorf("game %s: %v", g.ID, err)
+		}
+
+		if i < len(g.Clocks) {
+			clock := time.Duration(g.Clocks[i]) * 10 * time.Millisecond
+			annotations[i].Clock = &clock
+		}
+		if i < len(g.Analysis) {
+			analysis := g.Analysis[i]
+			switch {
+			case analysis.Mate != nil:
+				annotations[i].Eval = &pgn.Eval{Mate: *analysis.Mate}
+			case analysis.Eval != nil:
+				annotations[i].Eval = &pgn.Eval{Centipawns: *analysis.Eval}
+			}
+			if analysis.Judgment != nil {
+				annotations[i].Comment = analysis.Judgment.Comment
+			}
+		}
+	}
+	return &pgn.Game{
+		Game:        game,
+		Annotations: annotations,
+	}, nil
+}
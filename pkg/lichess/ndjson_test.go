@@ -0,0 +1,143 @@
+package lichess
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixture is a line of lichess games export requested with clocks=true, evals=true and opening=true
+const fixture = `{"id":"q7ZvsdUF","rated":true,"variant":"standard","speed":"blitz","perf":"blitz","createdAt":1620000000000,"lastMoveAt":1620000030000,"status":"mate","players":{"white":{"user":{"name":"alice"},"rating":1812},"black":{"aiLevel":3}},"winner":"black","opening":{"eco":"A00","name":"Barnes Opening: Fool's Mate","ply":4},"moves":"f3 e5 g4 Qh4#","clocks":[18003,18003,17950,17801],"clock":{"initial":180,"increment":2},"analysis":[{"eval":-45},{"eval":-38},{"mate":-1,"best":"g1h3","judgment":{"name":"Blunder","comment":"Checkmate is now unavoidable. Nh3 was best."}}]}
+`
+
+func TestDecodeGame(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(fixture))
+	game, err := dec.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last game, got %v", err)
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range game.Tags() {
+		tags[tag.Key] = tag.Value
+	}
+	expectedTags := map[string]string{
+		"Event":       "Rated blitz game",
+		"Site":        "https://lichess.org/q7ZvsdUF",
+		"Date":        "2021.05.03",
+		"White":       "alice",
+		"Black":       "lichess AI level 3",
+		"Result":      "0-1",
+		"UTCDate":     "2021.05.03",
+		"UTCTime":     "00:00:00",
+		"Variant":     "Standard",
+		"WhiteElo":    "1812",
+		"TimeControl": "180+2",
+		"ECO":         "A00",
+		"Opening":     "Barnes Opening: Fool's Mate",
+	}
+	for key, value := range expectedTags {
+		if tags[key] != value {
+			t.Errorf("expected tag %s %q, got %q", key, value, tags[key])
+		}
+	}
+	// ai has no rating and game starts from initial position
+	for _, key := range []string{"BlackElo", "FEN", "SetUp"} {
+		if _, ok := tags[key]; ok {
+			t.Errorf("unexpected tag %s", key)
+		}
+	}
+
+	pgnGame, err := game.PGN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pgnGame.Moves()) != 4 || pgnGame.Outcome() != "0-1" {
+		t.Errorf("unexpected game %s", pgnGame.String())
+	}
+	if len(pgnGame.Annotations) != 4 {
+		t.Fatalf("expected annotation for every ply, got %d", len(pgnGame.Annotations))
+	}
+
+	expectedClocks := []time.Duration{
+		180*time.Second + 30*time.Millisecond,
+		180*time.Second + 30*time.Millisecond,
+		179*time.Second + 500*time.Millisecond,
+		178*time.Second + 10*time.Millisecond,
+	}
+	for i, clock := range expectedClocks {
+		a := pgnGame.Annotations[i]
+		if a.Clock == nil || *a.Clock != clock {
+			t.Errorf("expected clock %v after ply %d, got %v", clock, i, a.Clock)
+		}
+	}
+
+	a := pgnGame.Annotations
+	if a[0].Eval == nil || a[0].Eval.Centipawns != -45 || a[0].Eval.Mate != 0 {
+		t.Errorf("unexpected eval after 1. f3 %+v", a[0].Eval)
+	}
+	if a[1].Eval == nil || a[1].Eval.Centipawns != -38 {
+		t.Errorf("unexpected eval after 1... e5 %+v", a[1].Eval)
+	}
+	if a[2].Eval == nil || a[2].Eval.Mate != -1 || a[2].Eval.Centipawns != 0 {
+		t.Errorf("expected mate after 2. g4, got %+v", a[2].Eval)
+	}
+	if a[2].Comment != "Checkmate is now unavoidable. Nh3 was best." {
+		t.Errorf("expected judgment comment after 2. g4, got %q", a[2].Comment)
+	}
+	// analysis ends before the final position
+	if a[3].Eval != nil || a[3].Comment != "" {
+		t.Errorf("unexpected annotation after 2... Qh4# %+v", a[3])
+	}
+}
+
+func TestResult(t *testing.T) {
+	tests := []struct {
+		winner   string
+		status   string
+		expected string
+	}{
+		{"white", "resign", "1-0"},
+		{"black", "outoftime", "0-1"},
+		{"", "draw", "1/2-1/2"},
+		{"", "stalemate", "1/2-1/2"},
+		{"", "started", "*"},
+		{"", "created", "*"},
+	}
+	for _, test := range tests {
+		game := Game{Winner: test.winner, Status: test.status}
+		if result := game.Result(); result != test.expected {
+			t.Errorf("expected %s for winner %q and status %s, got %s", test.expected, test.winner, test.status, result)
+		}
+	}
+}
+
+func TestPGNFromPosition(t *testing.T) {
+	game := Game{
+		ID:         "fromPos1",
+		Variant:    "fromPosition",
+		InitialFEN: "7k/8/8/8/8/8/1R6/R5K1 w - - 0 1",
+		Moves:      "Ra7 Kg8 Rb8#",
+		Winner:     "white",
+		Status:     "mate",
+	}
+	pgnGame, err := game.PGN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pgnGame.Moves()) != 3 || pgnGame.Outcome() != "1-0" {
+		t.Errorf("unexpected game %s", pgnGame.String())
+	}
+	if pgnGame.GetTagPair("FEN").Value != game.InitialFEN || pgnGame.GetTagPair("SetUp").Value != "1" {
+		t.Errorf("expected FEN and SetUp tags, got %v", pgnGame.TagPairs())
+	}
+
+	game.Moves = "Ra7 Kh7"
+	if _, err := game.PGN(); err == nil {
+		t.Error("expected error for illegal move")
+	}
+}
@@ -0,0 +1,176 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+type Font string
+
+// only standard fonts are used, so nothing has to be embedded
+const (
+	Regular Font = "F1"
+	Bold    Font = "F2"
+)
+
+var baseFonts = map[Font]string{
+	Regular: "Helvetica",
+	Bold:    "Helvetica-Bold",
+}
+
+// Document is a minimal PDF writer supporting text, filled rectangles and polygons
+type Document struct {
+	pages []*Page
+}
+
+// Page uses coordinates with origin in top left corner and y axis going down
+type Page struct {
+	content bytes.Buffer
+}
+
+func NewDocument() *Document {
+	return &Document{}
+}
+
+func (d *Document) AddPage() *Page {
+	page := &Page{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
+
+// Gray sets fill and stroke colors, 0 is black and 1 is white
+func (p *Page) Gray(fill float64, stroke float64) {
+	fmt.Fprintf(&p.content, "%s g %s G\n", num(fill), num(stroke))
+}
+
+// RGB sets fill and stroke colors with components from 0 to 1
+func (p *Page) RGB(fillR float64, fillG float64, fillB float64, strokeR float64, strokeG float64, strokeB float64) {
+	fmt.Fprintf(&p.content, "%s %s %s rg %s %s %s RG\n", num(fillR), num(fillG), num(fillB), num(strokeR), num(strokeG), num(strokeB))
+}
+
+func (p *Page) LineWidth(w float64) {
+	fmt.Fprintf(&p.content, "%s w\n", num(w))
+}
+
+func (p *Page) Rect(x float64, y float64, w float64, h float64, fill bool, stroke bool) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re %s\n", num(x), num(PageHeight-y-h), num(w), num(h), paintOp(fill, stroke))
+}
+
+func (p *Page) Polygon(xs []float64, ys []float64, fill bool, stroke bool) {
+	for i := range xs {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&p.content, "%s %s %s\n", num(xs[i]), num(PageHeight-ys[i]), op)
+	}
+	fmt.Fprintf(&p.content, "h %s\n", paintOp(fill, stroke))
+}
+
+func paintOp(fill bool, stroke bool) string {
+	switch {
+	case fill && stroke:
+		return "B"
+	case fill:
+		return "f"
+	case stroke:
+		return "S"
+	}
+	return "n"
+}
+
+// Text writes single line with baseline at y
+func (p *Page) Text(x float64, y float64, font Font, size float64, text string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, num(size), num(x), num(PageHeight-y), escape(text))
+}
+
+// winAnsiExtra maps characters which WinAnsiEncoding places at codes 128-159 instead of control characters
+var winAnsiExtra = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// winAnsi returns code of the character in WinAnsiEncoding of standard fonts, which matches Latin-1 above 159
+func winAnsi(r rune) (byte, bool) {
+	if r >= 32 && r <= 126 || r >= 160 && r <= 255 {
+		return byte(r), true
+	}
+	code, ok := winAnsiExtra[r]
+	return code, ok
+}
+
+// escape quotes string for PDF literal, characters missing in WinAnsiEncoding are replaced as standard fonts can't show them
+func escape(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		code, ok := winAnsi(r)
+		switch {
+		case !ok:
+			sb.WriteByte('?')
+		case code == '(' || code == ')' || code == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(code)
+		case code > 126:
+			// content stream stays ASCII
+			fmt.Fprintf(&sb, "\\%03o", code)
+		default:
+			sb.WriteByte(code)
+		}
+	}
+	return sb.String()
+}
+
+// Write serializes document: catalog, page tree, fonts, then page and content stream pairs
+func (d *Document) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	offsets := make([]int, 0)
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	const firstPageObject = 5
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", baseFonts[Regular]))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", baseFonts[Bold]))
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			num(PageWidth), num(PageHeight), Regular, Bold, firstPageObject+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
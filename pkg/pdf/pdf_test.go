@@ -0,0 +1,35 @@
+package pdf
+
+import "testing"
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"Carlsen", "Carlsen"},
+		{`(a\b)`, `\(a\\b\)`},
+		{"Réti", `R\351ti`},
+		{"Nepomniachtchi – Ding", `Nepomniachtchi \226 Ding`},
+		{"Šahovski", `\212ahovski`},
+		{"Непомнящий", "??????????"},
+		{"line\nbreak", "line?break"},
+	}
+	for _, test := range tests {
+		if escaped := escape(test.text); escaped != test.expected {
+			t.Errorf("expected %s for %q, got %s", test.expected, test.text, escaped)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if w := TextWidth(Regular, 10, "Réti"); w != TextWidth(Regular, 10, "Reti") {
+		t.Errorf("accented letter should be as wide as plain one, got %v", w)
+	}
+	if w := TextWidth(Bold, 10, "Æ"); w != 10 {
+		t.Errorf("expected width 10 of AE ligature, got %v", w)
+	}
+	if w := TextWidth(Regular, 10, "Ж"); w != TextWidth(Regular, 10, "?") {
+		t.Errorf("missing character should be measured as question mark, got %v", w)
+	}
+}
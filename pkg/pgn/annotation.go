@@ -0,0 +1,91 @@
+package pgn
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Eval is engine evaluation from white side, Mate is set instead of Centipawns when mate is found
+type Eval struct {
+	Centipawns int `json:"cp,omitempty" bson:"cp,omitempty"`
+	// Mate is number of moves to mate, it is negative when black mates
+	Mate int `json:"mate,omitempty" bson:"mate,omitempty"`
+}
+
+// Annotation is comment of a single move with commands embedded by lichess and chess.com
+type Annotation struct {
+	Comment string `json:"comment,omitempty" bson:"comment,omitempty"`
+	// Clock is remaining time of player after the move
+	Clock *time.Duration `json:"clock,omitempty" bson:"clock,omitempty"`
+	// Eval is evaluation of position after the move
+	Eval *Eval `json:"eval,omitempty" bson:"eval,omitempty"`
+}
+
+var commandRegex = regexp.MustCompile(`\[%(\w+)\s+([^\]]*)\]`)
+
+// parseComment extracts %clk and %eval commands, other commands are left in comment text
+func parseComment(comment string) Annotation {
+	var a Annotation
+	text := commandRegex.ReplaceAllStringFunc(comment, func(command string) string {
+		match := commandRegex.FindStringSubmatch(command)
+		switch match[1] {
+		case "clk":
+			if clock, ok := parseClock(match[2]); ok {
+				a.Clock = &clock
+				return ""
+			}
+		case "eval":
+			if eval, ok := parseEval(match[2]); ok {
+				a.Eval = &eval
+				return ""
+			}
+		}
+		return command
+	})
+	a.Comment = strings.Join(strings.Fields(text), " ")
+	return a
+}
+
+// parseClock parses h:mm:ss with optional fraction of second
+func parseClock(s string) (time.Duration, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)), true
+}
+
+// parseEval parses pawns like 0.23 or mate like #-3, optional search depth after comma is ignored
+func parseEval(s string) (Eval, bool) {
+	s = strings.TrimSpace(strings.Split(s, ",")[0])
+	if strings.HasPrefix(s, "#") {
+		mate, err := strconv.Atoi(s[1:])
+		if err != nil {
+			return Eval{}, false
+		}
+		return Eval{Mate: mate}, true
+	}
+	pawns, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Eval{}, false
+	}
+	if pawns < 0 {
+		return Eval{Centipawns: int(pawns*100 - 0.5)}, true
+	}
+	return Eval{Centipawns: int(pawns*100 + 0.5)}, true
+}
@@ -0,0 +1,52 @@
+package pgn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseComment(t *testing.T) {
+	clock := func(d time.Duration) *time.Duration {
+		return &d
+	}
+	tests := []struct {
+		name    string
+		comment string
+		text    string
+		clock   *time.Duration
+		eval    *Eval
+	}{
+		{"clock", "[%clk 0:03:25]", "", clock(3*time.Minute + 25*time.Second), nil},
+		{"clock with fraction", "[%clk 1:00:00.5]", "", clock(time.Hour + 500*time.Millisecond), nil},
+		{"pawns", "[%eval 0.46]", "", nil, &Eval{Centipawns: 46}},
+		{"negative pawns are rounded away from zero", "[%eval -0.456]", "", nil, &Eval{Centipawns: -46}},
+		{"small negative pawns", "[%eval -0.004]", "", nil, &Eval{}},
+		{"depth suffix", "[%eval 1.5,23]", "", nil, &Eval{Centipawns: 150}},
+		{"mate", "[%eval #3]", "", nil, &Eval{Mate: 3}},
+		{"black mates", "[%eval #-3]", "", nil, &Eval{Mate: -3}},
+		{"mate with depth", "[%eval #-3,40]", "", nil, &Eval{Mate: -3}},
+		{
+			"commands with text",
+			"Blunder. [%eval -2.1] [%clk 0:00:09] Qxd5 was better",
+			"Blunder. Qxd5 was better",
+			clock(9 * time.Second),
+			&Eval{Centipawns: -210},
+		},
+		{"unknown command is kept", "[%csl Ga4] good", "[%csl Ga4] good", nil, nil},
+		{"malformed commands are kept", "[%eval abc] [%clk 3:25]", "[%eval abc] [%clk 3:25]", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := parseComment(test.comment)
+			if a.Comment != test.text {
+				t.Errorf("expected comment %q, got %q", test.text, a.Comment)
+			}
+			if (a.Clock == nil) != (test.clock == nil) || a.Clock != nil && *a.Clock != *test.clock {
+				t.Errorf("expected clock %v, got %v", test.clock, a.Clock)
+			}
+			if (a.Eval == nil) != (test.eval == nil) || a.Eval != nil && *a.Eval != *test.eval {
+				t.Errorf("expected eval %+v, got %+v", test.eval, a.Eval)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package pgn
+
+import (
+	"bufio"
+	"github.com/notnil/chess"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Game is parsed game with comments of its moves
+type Game struct {
+	*chess.Game
+	// Annotations are indexed by ply, moves without comment have empty annotation
+	Annotations []Annotation
+}
+
+// Reader reads games one by one from concatenated PGN stream,
+// unlike chess.Scanner it doesn't rely on number of blank lines between games
+type Reader struct {
+	scanner *bufio.Scanner
+	// pending is first tag line of the next game, it is read while looking for end of current game
+	pending string
+	games   int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Games returns number of games read so far
+func (r *Reader) Games() int {
+	return r.games
+}
+
+// NextRaw returns text of the next game without parsing it, io.EOF is returned after the last game.
+// Every tag pair is put on its own line and movetext is joined into single line
+func (r *Reader) NextRaw() (string, error) {
+	var tags, movetext []string
+	if r.pending != "" {
+		tags = append(tags, r.pending)
+		r.pending = ""
+	}
+	commentDepth := 0
+	for r.scanner.Scan() {
+		line := strings.TrimSpace(r.scanner.Text())
+		// lines starting with % are escaped from pgn processing
+		if line == "" || strings.HasPrefix(line, "%") {
+			continue
+		}
+		if commentDepth == 0 && strings.HasPrefix(line, "[") {
+			if len(movetext) > 0 {
+				r.pending = line
+				break
+			}
+			tags = append(tags, line)
+			continue
+		}
+		line, commentDepth = closeLineComment(line, commentDepth)
+		movetext = append(movetext, line)
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(tags) == 0 && len(movetext) == 0 {
+		return "", io.EOF
+	}
+	r.games++
+	return strings.Join(tags, "\n") + "\n\n" + strings.Join(movetext, " ") + "\n", nil
+}
+
+// closeLineComment turns comment till end of line started with ; into brace comment,
+// so line can be joined with the following ones, depth of brace comments after the line is returned
+func closeLineComment(line string, depth int) (string, int) {
+	for i, c := range line {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case ';':
+			if depth == 0 {
+				return line[:i] + "{" + strings.ReplaceAll(line[i+1:], "}", "") + "}", 0
+			}
+		}
+	}
+	return line, depth
+}
+
+// Next returns the next parsed game, io.EOF is returned after the last game
+func (r *Reader) Next() (*Game, error) {
+	text, err := r.NextRaw()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(text)
+}
+
+var (
+	tagLineRegex = regexp.MustCompile(`^\[\w+\s+".*"\]$`)
+	moveNumRegex = regexp.MustCompile(`^\d+\.+`)
+)
+
+// Parse parses text of a single game, variations and numeric annotation glyphs are skipped
+func Parse(text string) (*Game, error) {
+	var tags []string
+	var movetext strings.Builder
+	commentDepth := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if commentDepth == 0 && tagLineRegex.MatchString(line) {
+			tags = append(tags, line)
+		} else if line != "" {
+			line, commentDepth = closeLineComment(line, commentDepth)
+			movetext.WriteString(line + " ")
+		}
+	}
+
+	moves, annotations, result := splitMovetext(movetext.String())
+	clean := strings.Join(tags, "\n") + "\n\n" + strings.Join(append(moves, result), " ") + "\n"
+	pgn, err := chess.PGN(strings.NewReader(clean))
+	if err != nil {
+		return nil, err
+	}
+	return &Game{
+		Game:        chess.NewGame(pgn),
+		Annotations: annotations,
+	}, nil
+}
+
+// splitMovetext returns moves of main line with their annotations and game result
+func splitMovetext(movetext string) ([]string, []Annotation, string) {
+	moves := make([]string, 0)
+	annotations := make([]Annotation, 0)
+	result := "*"
+	variationDepth := 0
+	for i := 0; i < len(movetext); {
+		c := movetext[i]
+		switch {
+		case c == '{':
+			end := strings.IndexByte(movetext[i:], '}')
+			if end < 0 {
+				end = len(movetext) - i
+			}
+			// comments before the first move and inside variations are dropped
+			if variationDepth == 0 && len(annotations) > 0 {
+				last := &annotations[len(annotations)-1]
+				annotation := parseComment(movetext[i+1 : i+end])
+				if last.Comment != "" && annotation.Comment != "" {
+					annotation.Comment = last.Comment + " " + annotation.Comment
+				} else if annotation.Comment == "" {
+					annotation.Comment = last.Comment
+				}
+				if annotation.Clock == nil {
+					annotation.Clock = last.Clock
+				}
+				if annotation.Eval == nil {
+					annotation.Eval = last.Eval
+				}
+				*last = annotation
+			}
+			i += end + 1
+		case c == '(':
+			variationDepth++
+			i++
+		case c == ')':
+			if variationDepth > 0 {
+				variationDepth--
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		default:
+			end := strings.IndexAny(movetext[i:], " \t\r\n{}()")
+			if end < 0 {
+				end = len(movetext) - i
+			}
+			if end == 0 {
+				// unmatched closing brace
+				i++
+				continue
+			}
+			token := movetext[i : i+end]
+			i += end
+			if variationDepth > 0 || strings.HasPrefix(token, "$") {
+				continue
+			}
+			switch token {
+			case "1-0", "0-1", "1/2-1/2", "*":
+				result = token
+				continue
+			}
+			token = strings.TrimRight(moveNumRegex.ReplaceAllString(token, ""), "!?")
+			if token == "" {
+				continue
+			}
+			moves = append(moves, token)
+			annotations = append(annotations, Annotation{})
+		}
+	}
+	return moves, annotations, result
+}
+
+// ReadAll returns all games of the stream
+func ReadAll(r io.Reader) ([]*Game, error) {
+	reader := NewReader(r)
+	games := make([]*Game, 0)
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return games, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, game)
+	}
+}
@@ -0,0 +1,173 @@
+package pgn
+
+import (
+	"github.com/notnil/chess"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReaderGameBoundaries(t *testing.T) {
+	// second game starts right after movetext of the first one without blank line,
+	// tag-like line inside multi-line comment doesn't start a new game
+	const text = `[White "first"]
+[Black "second"]
+1. f3 e5 2. g4 { a comment
+[not a tag] which spans lines } Qh4# 0-1
+[White "third"]
+[Black "fourth"]
+
+% escaped line
+1. e4 e5 1/2-1/2`
+
+	reader := NewReader(strings.NewReader(text))
+	first, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.GetTagPair("White").Value != "first" || len(first.Moves()) != 4 {
+		t.Errorf("unexpected first game %s", first.String())
+	}
+	second, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.GetTagPair("White").Value != "third" || len(second.Moves()) != 2 {
+		t.Errorf("unexpected second game %s", second.String())
+	}
+	if reader.Games() != 2 {
+		t.Errorf("expected 2 games read, got %d", reader.Games())
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last game, got %v", err)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	const text = `[Event "Live Chess"]
+[White "first"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+
+
+[Event "Live Chess"]
+[White "third"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`
+	games, err := ReadAll(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+	if games[0].GetTagPair("White").Value != "first" || len(games[0].Moves()) != 7 {
+		t.Errorf("unexpected first game %s", games[0].String())
+	}
+	if games[1].GetTagPair("White").Value != "third" || len(games[1].Moves()) != 4 {
+		t.Errorf("unexpected second game %s", games[1].String())
+	}
+
+	if games, err := ReadAll(strings.NewReader("")); err != nil || len(games) != 0 {
+		t.Errorf("expected no games in empty stream, got %v, %v", games, err)
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	const text = `[White "first"]
+[Black "second"]
+
+{ opening comment } 1. e4 { [%eval 0.3] [%clk 0:03:00] } 1... e5 { [%clk 0:02:58]
+multi-line comment } 2. Nf3 $1 (2. Qh5 { variation comment } Nc6 (2... g6) 3. Bc4) 2... Nc6!? ; line comment with { brace
+3. Bb5 { [%eval #-3,12] } 1-0`
+
+	game, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := game.Moves()
+	expectedMoves := []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1b5"}
+	if len(moves) != len(expectedMoves) {
+		t.Fatalf("expected %d moves of main line, got %d", len(expectedMoves), len(moves))
+	}
+	for i, m := range moves {
+		if m.String() != expectedMoves[i] {
+			t.Errorf("expected move %d to be %s, got %s", i, expectedMoves[i], m.String())
+		}
+	}
+	if game.Outcome() != chess.WhiteWon {
+		t.Errorf("expected white won, got %s", game.Outcome())
+	}
+	if game.GetTagPair("White").Value != "first" {
+		t.Errorf("tags are lost")
+	}
+
+	if len(game.Annotations) != len(expectedMoves) {
+		t.Fatalf("expected annotation for every ply, got %d", len(game.Annotations))
+	}
+	a := game.Annotations
+	if a[0].Comment != "" || a[0].Eval == nil || a[0].Eval.Centipawns != 30 || a[0].Clock == nil || *a[0].Clock != 3*time.Minute {
+		t.Errorf("unexpected annotation of 1. e4 %+v", a[0])
+	}
+	if a[1].Comment != "multi-line comment" || a[1].Clock == nil || *a[1].Clock != 2*time.Minute+58*time.Second {
+		t.Errorf("unexpected annotation of 1... e5 %+v", a[1])
+	}
+	// variation comment belongs to variation which is dropped
+	if a[2].Comment != "" || a[2].Eval != nil {
+		t.Errorf("unexpected annotation of 2. Nf3 %+v", a[2])
+	}
+	if a[3].Comment != "line comment with { brace" {
+		t.Errorf("unexpected annotation of 2... Nc6 %+v", a[3])
+	}
+	if a[4].Eval == nil || a[4].Eval.Mate != -3 {
+		t.Errorf("unexpected annotation of 3. Bb5 %+v", a[4])
+	}
+}
+
+func TestReaderLineComment(t *testing.T) {
+	// brace in line comment doesn't hide the next game
+	const text = `[White "first"]
+
+1. e4 ; { unclosed
+1... e5 1/2-1/2
+[White "second"]
+
+1. d4 *`
+
+	games, err := ReadAll(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d", len(games))
+	}
+	if len(games[0].Moves()) != 2 || games[0].Annotations[0].Comment != "{ unclosed" {
+		t.Errorf("unexpected first game %s %+v", games[0].String(), games[0].Annotations)
+	}
+	if games[1].GetTagPair("White").Value != "second" || len(games[1].Moves()) != 1 {
+		t.Errorf("unexpected second game %s", games[1].String())
+	}
+}
+
+func TestParseTagInsideComment(t *testing.T) {
+	const text = `[White "first"]
+
+1. e4 { quoted game header
+[White "someone else"]
+} e5 *`
+
+	game, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.GetTagPair("White").Value != "first" || len(game.Moves()) != 2 {
+		t.Errorf("unexpected game %s", game.String())
+	}
+	if game.Annotations[0].Comment != `quoted game header [White "someone else"]` {
+		t.Errorf("unexpected comment %q", game.Annotations[0].Comment)
+	}
+}
@@ -1,102 +1,176 @@
 package puzgen
 
 import (
-	"github.com/freeeve/uci"
+	"context"
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
 	"github.com/notnil/chess"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	maxDepth   = 6
 	Layout     = "2006.01.02"
 	TimeLayout = "15:04:05"
 )
 
-func SetupEngine(path string, arg ...string) (*uci.Engine, error) {
-	e, err := uci.NewEngine(path, arg...)
+func SetupEngine(path string, opts GeneratorOptions, arg ...string) (Engine, error) {
+	return NewUCIEngine(path, opts.engineOptions(), arg...)
+}
+
+func AnalyzeGame(e Engine, game *chess.Game, opts GeneratorOptions) ([]Task, error) {
+	if !IsStandardGame(game) {
+		return []Task{}, nil
+	}
+	tasks, err := analyzeGame(context.Background(), &pgn.Game{Game: game}, e, opts)
 	if err != nil {
 		return nil, err
 	}
+	return tasks, nil
+}
 
-	err = e.SetOptions(uci.Options{
-		MultiPV: maxDepth,
-		Hash:    128,
-		Ponder:  false,
-		OwnBook: true,
-	})
-	if err != nil {
-		return nil, err
+// GameTasksFunc receives tasks of a single analyzed game by its index, it is called concurrently from analysis workers
+type GameTasksFunc func(gameInd int, tasks []Task) error
+
+// AnalyzeAllGames analyzes games concurrently using engines from pool and returns tasks in games order,
+// onGame is called as soon as every game is analyzed and its error stops analysis,
+// cancelling ctx stops running engine searches, known evaluations from annotations let skip quiet positions
+func AnalyzeAllGames(ctx context.Context, pool *EnginePool, games []*pgn.Game, onGame GameTasksFunc, opts GeneratorOptions) ([]Task, error) {
+	gameTasks := make([][]Task, len(games))
+	gameInds := make(chan int, len(games))
+	for ind := range games {
+		gameInds <- ind
+	}
+	close(gameInds)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(failed)
+		})
+	}
+
+	workers := pool.Size()
+	if len(games) < workers {
+		workers = len(games)
 	}
-	return e, nil
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ind := range gameInds {
+				select {
+				case <-failed:
+					return
+				default:
+				}
+				tasks, err := analyzeGameWithPool(ctx, pool, games[ind], opts)
+				if err != nil {
+					fail(err)
+					return
+				}
+				gameTasks[ind] = tasks
+				if onGame == nil {
+					continue
+				}
+				if err := onGame(ind, tasks); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	res := make([]Task, 0)
+	for _, tasks := range gameTasks {
+		res = append(res, tasks...)
+	}
+	return res, nil
 }
 
-func AnalyzeGame(path string, game *chess.Game, arg ...string) ([]Task, error) {
-	var e *uci.Engine
-	var err error
-	if e, err = SetupEngine(path, arg...); err != nil {
+func analyzeGameWithPool(ctx context.Context, pool *EnginePool, game *pgn.Game, opts GeneratorOptions) ([]Task, error) {
+	if !IsStandardGame(game.Game) {
+		log.Printf("skipping %s game %s\n", tagValue(game.Game, "Variant"), tagValue(game.Game, "Site"))
+		return []Task{}, nil
+	}
+	e, err := pool.Acquire()
+	if err != nil {
 		return nil, err
 	}
-	defer e.Close()
-	tasks, err := analyzeGame(game, e)
+	tasks, err := analyzeGame(ctx, game, e, opts)
 	if err != nil {
+		// engine is discarded even if analysis was cancelled since cancelled search stops the engine
+		pool.Discard(e)
 		return nil, err
 	}
+	pool.Release(e)
 	return tasks, nil
 }
 
-func AnalyzeAllGames(path string, games []*chess.Game, progressChan chan<- struct{}, arg ...string) ([]Task, error) {
-	var e *uci.Engine
-	var err error
-	if e, err = SetupEngine(path, arg...); err != nil {
+func analyzeGame(ctx context.Context, g *pgn.Game, e Engine, opts GeneratorOptions) ([]Task, error) {
+	watchedPositions := make(map[string][]Turn, 0)
+	moves := g.Moves()
+	newGame, err := startingGame(g.Game)
+	if err != nil {
 		return nil, err
 	}
-	defer e.Close()
-
 	res := make([]Task, 0)
-
-	for _, game := range games {
-		newTasks, err := analyzeGame(game, e)
+	for ind, move := range moves {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := newGame.Move(move); err != nil {
+			return nil, fmt.Errorf("can't replay move %d of game %s: %v", ind+1, tagValue(g.Game, "Site"), err)
+		}
+		if ind < len(g.Annotations) && opts.noTaskExpected(g.Annotations[ind].Eval, newGame.Position().Turn()) {
+			continue
+		}
+		task, err := GenerateTaskFromPosition(ctx, *newGame, e, watchedPositions, opts)
 		if err != nil {
 			return nil, err
 		}
-		progressChan <- struct{}{}
-		res = append(res, newTasks...)
+		if task.StartFEN != "" {
+			elo := playerElo(g.Game, g.Position().Turn())
+			task.TargetELO = estimateAllElos(moves[ind:], *g.Game, task.FirstPossibleTurns, elo)
+			res = append(res, task)
+		}
 	}
 	return res, nil
 }
 
-func analyzeGame(g *chess.Game, e *uci.Engine) ([]Task, error) {
-	watchedPositions := make(map[string][]Turn, 0)
-	moves := g.Moves()
+// startingGame returns game with tags of g and without moves,
+// games set up from position (e.g. lichess games from position) start from their FEN tag
+func startingGame(g *chess.Game) (*chess.Game, error) {
 	newGame := chess.NewGame()
-	for _, tagPair := range g.TagPairs() {
-		newGame.AddTagPair(tagPair.Key, tagPair.Value)
-	}
-	res := make([]Task, 0)
-	for ind, move := range moves {
-		newGame.Move(move)
-		task, err := GenerateTaskFromPosition(*newGame, e, watchedPositions)
+	if fen := tagValue(g, "FEN"); fen != "" {
+		fenFunc, err := chess.FEN(fen)
 		if err != nil {
 			return nil, err
 		}
-		if task.StartFEN != "" {
-			var eloStr string
-			if g.Position().Turn() == chess.White {
-				eloStr = g.GetTagPair("WhiteElo").Value
-			} else {
-				eloStr = g.GetTagPair("BlackElo").Value
-			}
-			elo, _ := strconv.Atoi(eloStr)
-			task.TargetELO = estimateAllElos(moves[ind:], *g, task.FirstPossibleTurns, elo)
-			res = append(res, task)
-		}
+		newGame = chess.NewGame(fenFunc)
 	}
-	return res, nil
+	for _, tagPair := range g.TagPairs() {
+		newGame.AddTagPair(tagPair.Key, tagPair.Value)
+	}
+	return newGame, nil
 }
 
-func GenerateTaskFromPosition(game chess.Game, e *uci.Engine, watchedPositions map[string][]Turn) (Task, error) {
+// GenerateTaskFromPosition looks for forced mate in given position and,
+// if opts.MaterialThreshold is positive, for a single move winning at least opts.MaterialThreshold centipawns
+func GenerateTaskFromPosition(ctx context.Context, game chess.Game, e Engine, watchedPositions map[string][]Turn, opts GeneratorOptions) (Task, error) {
 	if _, ok := watchedPositions[game.FEN()]; ok {
 		return Task{}, nil
 	}
@@ -105,52 +179,45 @@ func GenerateTaskFromPosition(game chess.Game, e *uci.Engine, watchedPositions m
 	if err != nil {
 		return Task{}, err
 	}
-	result, err := e.GoDepth(maxDepth, uci.IncludeLowerbounds|uci.IncludeUpperbounds)
+	results, err := e.Search(ctx, opts.searchParams(opts.Depth))
 	if err != nil {
 		return Task{}, err
 	}
 
-	if len(result.Results) == 0 {
+	if len(results) == 0 {
 		return Task{}, nil
 	}
-	filteredResults := filterResults(result.Results)
+	filteredResults := filterResults(results, opts.ScoreTolerance)
 	possibleTurns := make([]Turn, 0)
 
-	if !result.Results[0].Mate || result.Results[0].Score <= 1 {
-		return Task{}, nil
-	}
-
-	for _, filteredResult := range filteredResults {
-		turn, err := generateCheckmate(game, e, filteredResult, watchedPositions)
+	var generator Generator
+	if results[0].Mate && opts.acceptsMate(results[0].Score) {
+		generator = CheckmateGenerator
+		for _, filteredResult := range filteredResults {
+			turn, err := generateCheckmate(ctx, game, e, filteredResult, watchedPositions, opts)
+			if err != nil {
+				return Task{}, err
+			}
+			if turn.SanNotation != "" {
+				possibleTurns = append(possibleTurns, turn)
+			}
+		}
+	} else if opts.MaterialThreshold > 0 && !results[0].Mate {
+		decisiveRes, ok := decisiveResult(results, opts.MaterialThreshold)
+		if !ok {
+			return Task{}, nil
+		}
+		generator = MaterialGenerator
+		turn, err := generateMaterial(ctx, game, e, decisiveRes, opts, maxMaterialLength, watchedPositions)
 		if err != nil {
 			return Task{}, err
 		}
-		if turn.SanNotation != "" {
-			possibleTurns = append(possibleTurns, turn)
-		}
-	}
-
-	var eloStr string
-	if game.Position().Turn() == chess.White {
-		eloStr = game.GetTagPair("WhiteElo").Value
+		possibleTurns = append(possibleTurns, turn)
 	} else {
-		eloStr = game.GetTagPair("BlackElo").Value
-	}
-	elo, _ := strconv.Atoi(eloStr)
-
-	extraTime, err := time.Parse(TimeLayout, game.GetTagPair("UTCTime").Value)
-	if err != nil {
-		return Task{}, err
-	}
-
-	gameTime, err := time.Parse(Layout, game.GetTagPair("UTCDate").Value)
-	if err != nil {
-		return Task{}, err
+		return Task{}, nil
 	}
 
-	gameTime = gameTime.Add(time.Second*time.Duration(extraTime.Second()) +
-		time.Minute*time.Duration(extraTime.Minute()) +
-		time.Hour*time.Duration(extraTime.Hour()))
+	elo := playerElo(&game, game.Position().Turn())
 
 	if len(possibleTurns) == 0 {
 		return Task{}, nil
@@ -161,12 +228,82 @@ func GenerateTaskFromPosition(game chess.Game, e *uci.Engine, watchedPositions m
 		FirstPossibleTurns: possibleTurns,
 		IsWhiteTurn:        game.Position().Turn() == chess.White,
 		TargetELO:          elo,
+		Generator:          generator,
 		GameData: GameData{
-			WhitePlayer: game.GetTagPair("White").Value,
-			BlackPlayer: game.GetTagPair("Black").Value,
-			Date:        primitive.NewDateTimeFromTime(gameTime),
+			WhitePlayer: tagValue(&game, "White"),
+			BlackPlayer: tagValue(&game, "Black"),
+			Date:        gameDate(&game),
 		},
 	}
 
+	if opts.ValidationDepth > 0 {
+		validation, err := ValidateTask(ctx, taskRes, e, opts)
+		if err != nil {
+			return Task{}, err
+		}
+		if validation.Ambiguous && opts.RejectAmbiguous {
+			log.Printf("Rejected task %s: %s\n", taskRes.StartFEN, validation.Reason)
+			return Task{}, nil
+		}
+		taskRes.Validation = &validation
+	}
+
+	taskRes.Themes, err = ClassifyThemes(taskRes)
+	if err != nil {
+		return Task{}, err
+	}
+	taskRes.ID = TaskID(taskRes)
+
 	return taskRes, nil
 }
+
+// IsStandardGame tells if game is played by standard rules, tasks are not generated from other variants.
+// Games from position are replayed from their FEN tag
+func IsStandardGame(game *chess.Game) bool {
+	switch strings.ToLower(tagValue(game, "Variant")) {
+	case "", "standard", "from position":
+		return true
+	}
+	return false
+}
+
+// tagValue returns empty string for tags missing in game
+func tagValue(game *chess.Game, key string) string {
+	tag := game.GetTagPair(key)
+	if tag == nil {
+		return ""
+	}
+	return tag.Value
+}
+
+// playerElo returns default rating if elo of player is unknown
+func playerElo(game *chess.Game, color chess.Color) int {
+	key := "BlackElo"
+	if color == chess.White {
+		key = "WhiteElo"
+	}
+	elo, err := strconv.Atoi(tagValue(game, key))
+	if err != nil || elo <= 0 {
+		return rating.DefaultRating
+	}
+	return elo
+}
+
+// gameDate uses UTC tags of online games and falls back to Date tag of over the board ones,
+// zero date is returned if the date is unknown
+func gameDate(game *chess.Game) primitive.DateTime {
+	date := tagValue(game, "UTCDate")
+	if date == "" {
+		date = tagValue(game, "Date")
+	}
+	gameTime, err := time.Parse(Layout, date)
+	if err != nil {
+		return 0
+	}
+	if extraTime, err := time.Parse(TimeLayout, tagValue(game, "UTCTime")); err == nil {
+		gameTime = gameTime.Add(time.Second*time.Duration(extraTime.Second()) +
+			time.Minute*time.Duration(extraTime.Minute()) +
+			time.Hour*time.Duration(extraTime.Hour()))
+	}
+	return primitive.NewDateTimeFromTime(gameTime)
+}
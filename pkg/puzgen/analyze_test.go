@@ -0,0 +1,345 @@
+package puzgen
+
+import (
+	"context"
+	"github.com/freeeve/uci"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
+	"github.com/notnil/chess"
+	"testing"
+	"time"
+)
+
+const (
+	// ladder mate: 1. Ra7 Kg8 2. Rb8#
+	mateFEN = "7k/8/8/8/8/8/1R6/R5K1 w - - 0 1"
+	// hanging queen is won by 1. Rxd5
+	materialFEN = "4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1"
+)
+
+func gameFromFEN(t *testing.T, fen string) chess.Game {
+	fenFunc, err := chess.FEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := chess.NewGame(fenFunc)
+	game.AddTagPair("White", "white")
+	game.AddTagPair("Black", "black")
+	game.AddTagPair("WhiteElo", "1800")
+	game.AddTagPair("BlackElo", "1700")
+	game.AddTagPair("UTCDate", "2021.05.01")
+	game.AddTagPair("UTCTime", "12:00:00")
+	return *game
+}
+
+// fenAfter returns position after moves in UCI notation are played from fen
+func fenAfter(t *testing.T, fen string, moves ...string) string {
+	game := gameFromFEN(t, fen)
+	for _, move := range moves {
+		m, err := chess.UCINotation{}.Decode(game.Position(), move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := game.Move(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return game.FEN()
+}
+
+func TestGenerateTaskFromPositionMate(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		mateFEN: {
+			{Depth: 6, MultiPV: 1, Mate: true, Score: 2, BestMoves: []string{"a1a7", "h8g8", "b2b8"}},
+			{Depth: 6, MultiPV: 2, Score: 500, BestMoves: []string{"b2b7"}},
+		},
+		fenAfter(t, mateFEN, "a1a7", "h8g8"): {
+			{Depth: 2, MultiPV: 1, Mate: true, Score: 1, BestMoves: []string{"b2b8"}},
+		},
+	})
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, mateFEN), e, map[string][]Turn{}, DefaultGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Generator != CheckmateGenerator {
+		t.Fatalf("expected checkmate task, got %q", task.Generator)
+	}
+	if len(task.FirstPossibleTurns) != 1 {
+		t.Fatalf("expected single solution, got %v", task.FirstPossibleTurns)
+	}
+	turn := task.FirstPossibleTurns[0]
+	if turn.SanNotation != "Ra7" || turn.IsLastTurn || turn.AnswerTurnSanNotation != "Kg8" {
+		t.Errorf("expected Ra7 answered by Kg8, got %v", turn)
+	}
+	if len(turn.ContinueVariations) != 1 || turn.ContinueVariations[0].SanNotation != "Rb8" || !turn.ContinueVariations[0].IsLastTurn {
+		t.Errorf("expected mate by Rb8, got %v", turn.ContinueVariations)
+	}
+	if task.StartFEN != mateFEN || !task.IsWhiteTurn || task.TargetELO != 1800 {
+		t.Errorf("unexpected position %s, white turn %v, elo %d", task.StartFEN, task.IsWhiteTurn, task.TargetELO)
+	}
+	if task.GameData.WhitePlayer != "white" || task.GameData.BlackPlayer != "black" {
+		t.Errorf("unexpected game data %+v", task.GameData)
+	}
+	if task.Validation == nil || task.Validation.Ambiguous {
+		t.Errorf("expected unambiguous validation, got %+v", task.Validation)
+	}
+}
+
+func TestGenerateTaskFromPositionAmbiguous(t *testing.T) {
+	// 1. Rb7 mates as fast, but its continuation is unknown, so it is not accepted as solution
+	results := map[string][]uci.ScoreResult{
+		mateFEN: {
+			{Depth: 6, MultiPV: 1, Mate: true, Score: 2, BestMoves: []string{"a1a7", "h8g8", "b2b8"}},
+			{Depth: 6, MultiPV: 2, Mate: true, Score: 2, BestMoves: []string{"b2b7", "h8g8", "a1a8"}},
+		},
+		fenAfter(t, mateFEN, "a1a7", "h8g8"): {
+			{Depth: 2, MultiPV: 1, Mate: true, Score: 1, BestMoves: []string{"b2b8"}},
+		},
+	}
+	opts := DefaultGeneratorOptions()
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, mateFEN), NewScriptedEngine(results), map[string][]Turn{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Validation == nil || !task.Validation.Ambiguous || task.Validation.Reason == "" {
+		t.Errorf("expected ambiguous validation with reason, got %+v", task.Validation)
+	}
+
+	opts.RejectAmbiguous = true
+	task, err = GenerateTaskFromPosition(context.Background(), gameFromFEN(t, mateFEN), NewScriptedEngine(results), map[string][]Turn{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StartFEN != "" {
+		t.Errorf("ambiguous task should be rejected, got %v", task)
+	}
+}
+
+func TestGenerateTaskFromPositionShortMate(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		mateFEN: {{Depth: 6, MultiPV: 1, Mate: true, Score: 1, BestMoves: []string{"b2b8"}}},
+	})
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, mateFEN), e, map[string][]Turn{}, DefaultGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StartFEN != "" {
+		t.Errorf("mate in one shouldn't become a task, got %v", task)
+	}
+}
+
+func TestGenerateTaskFromPositionMateLength(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		mateFEN: {{Depth: 6, MultiPV: 1, Mate: true, Score: 1, BestMoves: []string{"b2b8"}}},
+	})
+	opts := DefaultGeneratorOptions()
+	opts.MinMateLength = 1
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, mateFEN), e, map[string][]Turn{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(task.FirstPossibleTurns) != 1 || task.FirstPossibleTurns[0].SanNotation != "Rb8" {
+		t.Errorf("expected mate in one with MinMateLength 1, got %v", task)
+	}
+
+	opts.MinMateLength = 3
+	task, err = GenerateTaskFromPosition(context.Background(), gameFromFEN(t, mateFEN), e, map[string][]Turn{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StartFEN != "" {
+		t.Errorf("mate shorter than MinMateLength shouldn't become a task, got %v", task)
+	}
+}
+
+func TestGenerateTaskFromPositionMaterial(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		materialFEN: {
+			{Depth: 6, MultiPV: 1, Score: 900, BestMoves: []string{"d1d5", "e8e7"}},
+			{Depth: 6, MultiPV: 2, Score: -900, BestMoves: []string{"e1e2"}},
+		},
+	})
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, materialFEN), e, map[string][]Turn{}, DefaultGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Generator != MaterialGenerator {
+		t.Fatalf("expected material task, got %q", task.Generator)
+	}
+	if len(task.FirstPossibleTurns) != 1 {
+		t.Fatalf("expected single solution, got %v", task.FirstPossibleTurns)
+	}
+	// position after the answer is unknown to engine, so combination ends with the capture
+	turn := task.FirstPossibleTurns[0]
+	if turn.SanNotation != "Rxd5" || !turn.IsLastTurn {
+		t.Errorf("expected last turn Rxd5, got %v", turn)
+	}
+	if task.Validation == nil || task.Validation.Ambiguous {
+		t.Errorf("expected unambiguous validation, got %+v", task.Validation)
+	}
+	if len(e.Searches) != 3 {
+		t.Errorf("expected search of start position, position after answer and validation, got %d searches", len(e.Searches))
+	}
+}
+
+func TestGenerateTaskFromPositionNoDecisiveMove(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		materialFEN: {
+			{Depth: 6, MultiPV: 1, Score: 900, BestMoves: []string{"d1d5"}},
+			{Depth: 6, MultiPV: 2, Score: 800, BestMoves: []string{"e1e2"}},
+		},
+	})
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, materialFEN), e, map[string][]Turn{}, DefaultGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StartFEN != "" {
+		t.Errorf("position with several winning moves shouldn't become a task, got %v", task)
+	}
+}
+
+func TestGenerateTaskFromPositionMaterialDisabled(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		materialFEN: {
+			{Depth: 6, MultiPV: 1, Score: 900, BestMoves: []string{"d1d5"}},
+			{Depth: 6, MultiPV: 2, Score: -900, BestMoves: []string{"e1e2"}},
+		},
+	})
+
+	opts := DefaultGeneratorOptions()
+	opts.MaterialThreshold = 0
+
+	task, err := GenerateTaskFromPosition(context.Background(), gameFromFEN(t, materialFEN), e, map[string][]Turn{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StartFEN != "" {
+		t.Errorf("material tasks shouldn't be generated with zero threshold, got %v", task)
+	}
+}
+
+func TestGenerateTaskFromPositionCancelled(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := GenerateTaskFromPosition(ctx, gameFromFEN(t, materialFEN), e, map[string][]Turn{}, DefaultGeneratorOptions())
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestGenerateTaskFromPositionWithoutTags(t *testing.T) {
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		materialFEN: {
+			{Depth: 6, MultiPV: 1, Score: 900, BestMoves: []string{"d1d5", "e8e7"}},
+			{Depth: 6, MultiPV: 2, Score: -900, BestMoves: []string{"e1e2"}},
+		},
+	})
+	fenFunc, err := chess.FEN(materialFEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := GenerateTaskFromPosition(context.Background(), *chess.NewGame(fenFunc), e, map[string][]Turn{}, DefaultGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StartFEN != materialFEN {
+		t.Fatalf("expected task from game without tags, got %v", task)
+	}
+	if task.GameData.WhitePlayer != "" || task.GameData.BlackPlayer != "" || task.GameData.Date != 0 {
+		t.Errorf("expected empty game data, got %+v", task.GameData)
+	}
+	if task.TargetELO != rating.DefaultRating {
+		t.Errorf("expected default rating for unknown elo, got %d", task.TargetELO)
+	}
+}
+
+func TestAnalyzeGameFromPosition(t *testing.T) {
+	// ladder mate position arises after 1. Kg1 Kh8
+	const setUpFEN = "6k1/8/8/8/8/8/1R6/R6K w - - 0 1"
+	game, err := pgn.Parse(`[White "white"]
+[Black "black"]
+[WhiteElo "1800"]
+[BlackElo "1700"]
+[Variant "From Position"]
+[SetUp "1"]
+[FEN "` + setUpFEN + `"]
+
+1. Kg1 Kh8 2. Ra7 Kg8 3. Rb8# 1-0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsStandardGame(game.Game) {
+		t.Fatal("game from position should be analyzed")
+	}
+	taskFEN := fenAfter(t, setUpFEN, "h1g1", "g8h8")
+	e := NewScriptedEngine(map[string][]uci.ScoreResult{
+		taskFEN: {
+			{Depth: 6, MultiPV: 1, Mate: true, Score: 2, BestMoves: []string{"a1a7", "h8g8", "b2b8"}},
+			{Depth: 6, MultiPV: 2, Score: 500, BestMoves: []string{"b2b7"}},
+		},
+		fenAfter(t, setUpFEN, "h1g1", "g8h8", "a1a7", "h8g8"): {
+			{Depth: 2, MultiPV: 1, Mate: true, Score: 1, BestMoves: []string{"b2b8"}},
+		},
+	})
+
+	tasks, err := analyzeGame(context.Background(), game, e, DefaultGeneratorOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].StartFEN != taskFEN {
+		t.Errorf("expected task in position %s, got %+v", taskFEN, tasks)
+	}
+}
+
+func TestAnalyzeGameIllegalMove(t *testing.T) {
+	game, err := pgn.Parse("1. e4 e5 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// moves of the standard game can't be replayed from another position
+	game.AddTagPair("FEN", mateFEN)
+
+	if _, err := analyzeGame(context.Background(), game, NewScriptedEngine(nil), DefaultGeneratorOptions()); err == nil {
+		t.Error("expected error for move which is illegal in starting position")
+	}
+}
+
+func TestGameDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     map[string]string
+		expected time.Time
+	}{
+		{"utc tags", map[string]string{"UTCDate": "2021.05.01", "UTCTime": "12:30:15", "Date": "2021.04.30"}, time.Date(2021, 5, 1, 12, 30, 15, 0, time.UTC)},
+		{"over the board", map[string]string{"Date": "1997.05.11"}, time.Date(1997, 5, 11, 0, 0, 0, 0, time.UTC)},
+		{"unknown date", map[string]string{"Date": "????.??.??"}, time.Time{}},
+		{"no tags", map[string]string{}, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := chess.NewGame()
+			for key, value := range test.tags {
+				game.AddTagPair(key, value)
+			}
+			date := gameDate(game)
+			if test.expected.IsZero() {
+				if date != 0 {
+					t.Errorf("expected zero date, got %v", date.Time())
+				}
+				return
+			}
+			if !date.Time().Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, date.Time())
+			}
+		})
+	}
+}
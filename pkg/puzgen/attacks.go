@@ -0,0 +1,150 @@
+package puzgen
+
+import "github.com/notnil/chess"
+
+type direction struct {
+	file int
+	rank int
+}
+
+var (
+	rookDirections   = []direction{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopDirections = []direction{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	queenDirections  = append(append([]direction{}, rookDirections...), bishopDirections...)
+	knightOffsets    = []direction{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+)
+
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   1,
+	chess.Knight: 3,
+	chess.Bishop: 3,
+	chess.Rook:   5,
+	chess.Queen:  9,
+	chess.King:   100,
+}
+
+func squareAt(file int, rank int) (chess.Square, bool) {
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return chess.NoSquare, false
+	}
+	return chess.Square(rank*8 + file), true
+}
+
+func shift(sq chess.Square, d direction) (chess.Square, bool) {
+	return squareAt(int(sq.File())+d.file, int(sq.Rank())+d.rank)
+}
+
+func sliderDirections(pt chess.PieceType) []direction {
+	switch pt {
+	case chess.Rook:
+		return rookDirections
+	case chess.Bishop:
+		return bishopDirections
+	case chess.Queen:
+		return queenDirections
+	}
+	return nil
+}
+
+// attackedSquares returns squares attacked by the piece standing on from
+func attackedSquares(board *chess.Board, from chess.Square) []chess.Square {
+	piece := board.Piece(from)
+	res := make([]chess.Square, 0)
+	switch piece.Type() {
+	case chess.NoPieceType:
+		return res
+	case chess.Pawn:
+		forward := 1
+		if piece.Color() == chess.Black {
+			forward = -1
+		}
+		for _, d := range []direction{{1, forward}, {-1, forward}} {
+			if sq, ok := shift(from, d); ok {
+				res = append(res, sq)
+			}
+		}
+	case chess.Knight:
+		for _, d := range knightOffsets {
+			if sq, ok := shift(from, d); ok {
+				res = append(res, sq)
+			}
+		}
+	case chess.King:
+		for _, d := range queenDirections {
+			if sq, ok := shift(from, d); ok {
+				res = append(res, sq)
+			}
+		}
+	default:
+		for _, d := range sliderDirections(piece.Type()) {
+			for sq, ok := shift(from, d); ok; sq, ok = shift(sq, d) {
+				res = append(res, sq)
+				if board.Piece(sq) != chess.NoPiece {
+					break
+				}
+			}
+		}
+	}
+	return res
+}
+
+func attacks(board *chess.Board, from chess.Square, target chess.Square) bool {
+	for _, sq := range attackedSquares(board, from) {
+		if sq == target {
+			return true
+		}
+	}
+	return false
+}
+
+// attackersOf returns squares of pieces with given color attacking target
+func attackersOf(board *chess.Board, target chess.Square, color chess.Color) []chess.Square {
+	res := make([]chess.Square, 0)
+	for sq, piece := range board.SquareMap() {
+		if piece.Color() == color && attacks(board, sq, target) {
+			res = append(res, sq)
+		}
+	}
+	return res
+}
+
+func kingSquare(board *chess.Board, color chess.Color) chess.Square {
+	for sq, piece := range board.SquareMap() {
+		if piece.Type() == chess.King && piece.Color() == color {
+			return sq
+		}
+	}
+	return chess.NoSquare
+}
+
+// lineBehind returns first two pieces met by the slider from given square in given direction
+func lineBehind(board *chess.Board, from chess.Square, d direction) (chess.Square, chess.Square) {
+	front, back := chess.NoSquare, chess.NoSquare
+	for sq, ok := shift(from, d); ok; sq, ok = shift(sq, d) {
+		if board.Piece(sq) == chess.NoPiece {
+			continue
+		}
+		if front == chess.NoSquare {
+			front = sq
+			continue
+		}
+		back = sq
+		break
+	}
+	return front, back
+}
+
+func materialBalance(board *chess.Board, color chess.Color) int {
+	balance := 0
+	for _, piece := range board.SquareMap() {
+		if piece.Type() == chess.King {
+			continue
+		}
+		if piece.Color() == color {
+			balance += pieceValues[piece.Type()]
+		} else {
+			balance -= pieceValues[piece.Type()]
+		}
+	}
+	return balance
+}
@@ -0,0 +1,90 @@
+package puzgen
+
+import (
+	"fmt"
+	"github.com/notnil/chess"
+	"strings"
+)
+
+type AttemptResult struct {
+	Correct               bool   `json:"correct"`
+	Finished              bool   `json:"finished"`
+	AnswerTurnSanNotation string `json:"answer_turn_san_notation,omitempty"`
+}
+
+// decodeMove accepts move both in SAN and UCI notations
+func decodeMove(pos *chess.Position, move string) (*chess.Move, error) {
+	m, err := chess.AlgebraicNotation{}.Decode(pos, move)
+	if err == nil {
+		return m, nil
+	}
+	m, err = chess.UCINotation{}.Decode(pos, move)
+	if err == nil {
+		for _, valid := range pos.ValidMoves() {
+			if valid.S1() == m.S1() && valid.S2() == m.S2() && valid.Promo() == m.Promo() {
+				return valid, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("move %s is not valid in position %s", move, pos.String())
+}
+
+// sameSan compares moves ignoring check marks, generated solutions don't have them
+func sameSan(a string, b string) bool {
+	return strings.TrimRight(a, "+#") == strings.TrimRight(b, "+#")
+}
+
+// CheckAttempt walks solution tree with solver moves (defender replies are taken from the tree)
+// and reports whether all of them are correct
+func CheckAttempt(task Task, moves []string) (AttemptResult, error) {
+	fenFunc, err := chess.FEN(task.StartFEN)
+	if err != nil {
+		return AttemptResult{}, err
+	}
+	pos := chess.NewGame(fenFunc).Position()
+	turns := task.FirstPossibleTurns
+
+	var result AttemptResult
+	for ind, moveStr := range moves {
+		if result.Finished {
+			return AttemptResult{}, fmt.Errorf("puzzle is already finished after %d moves", ind)
+		}
+		move, err := decodeMove(pos, moveStr)
+		if err != nil {
+			return AttemptResult{}, err
+		}
+		san := chess.AlgebraicNotation{}.Encode(pos, move)
+		after := pos.Update(move)
+
+		var turn *Turn
+		for i := range turns {
+			if sameSan(turns[i].SanNotation, san) {
+				turn = &turns[i]
+				break
+			}
+		}
+		if turn == nil {
+			// any checkmate is accepted even if it is not in the solution tree
+			if after.Status() == chess.Checkmate {
+				return AttemptResult{Correct: true, Finished: true}, nil
+			}
+			return AttemptResult{Correct: false}, nil
+		}
+
+		result = AttemptResult{
+			Correct:               true,
+			Finished:              turn.IsLastTurn,
+			AnswerTurnSanNotation: turn.AnswerTurnSanNotation,
+		}
+		if turn.IsLastTurn {
+			continue
+		}
+		answer, err := chess.AlgebraicNotation{}.Decode(after, turn.AnswerTurnSanNotation)
+		if err != nil {
+			return AttemptResult{}, err
+		}
+		pos = after.Update(answer)
+		turns = turn.ContinueVariations
+	}
+	return result, nil
+}
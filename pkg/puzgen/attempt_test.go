@@ -0,0 +1,67 @@
+package puzgen
+
+import (
+	"testing"
+)
+
+func TestCheckAttempt(t *testing.T) {
+	// generated solutions have no check marks
+	task := Task{
+		StartFEN: "4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1",
+		FirstPossibleTurns: []Turn{{
+			SanNotation:           "Rxd5",
+			AnswerTurnSanNotation: "Ke7",
+			ContinueVariations:    []Turn{{SanNotation: "Re5", IsLastTurn: true}},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		moves    []string
+		expected AttemptResult
+	}{
+		{"full solution", []string{"Rxd5", "Re5+"}, AttemptResult{Correct: true, Finished: true}},
+		{"first move", []string{"Rxd5"}, AttemptResult{Correct: true, AnswerTurnSanNotation: "Ke7"}},
+		{"uci moves", []string{"d1d5", "d5e5"}, AttemptResult{Correct: true, Finished: true}},
+		{"wrong first move", []string{"Ke2"}, AttemptResult{}},
+		{"wrong second move", []string{"Rxd5", "Rd1"}, AttemptResult{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := CheckAttempt(task, test.moves)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCheckAttemptErrors(t *testing.T) {
+	task := Task{
+		StartFEN:           "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1",
+		FirstPossibleTurns: []Turn{{SanNotation: "Ra8", IsLastTurn: true}},
+	}
+	if _, err := CheckAttempt(task, []string{"Ra8#", "Kf8"}); err == nil {
+		t.Error("expected error for moves after finished puzzle")
+	}
+	if _, err := CheckAttempt(task, []string{"Rb2b8"}); err == nil {
+		t.Error("expected error for invalid move")
+	}
+}
+
+func TestCheckAttemptAnyCheckmate(t *testing.T) {
+	task := Task{
+		StartFEN:           "6k1/5ppp/8/8/8/8/8/RR4K1 w - - 0 1",
+		FirstPossibleTurns: []Turn{{SanNotation: "Ra8", IsLastTurn: true}},
+	}
+	result, err := CheckAttempt(task, []string{"Rb8#"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Correct || !result.Finished {
+		t.Errorf("checkmate missing in solution tree should be accepted, got %+v", result)
+	}
+}
@@ -0,0 +1,96 @@
+package puzgen
+
+import (
+	"context"
+	"fmt"
+	"github.com/freeeve/uci"
+	"time"
+)
+
+type SearchParams struct {
+	Depth    int
+	MoveTime time.Duration
+	MultiPV  int
+}
+
+// Engine is a chess engine used for positions analysis
+type Engine interface {
+	SetFEN(fen string) error
+	// Search returns all lines reported by engine (including lower and upper bounds) for position set by SetFEN,
+	// cancelling ctx stops the search and engine may become unusable
+	Search(ctx context.Context, params SearchParams) ([]uci.ScoreResult, error)
+	Close()
+}
+
+type UCIEngine struct {
+	engine  *uci.Engine
+	multiPV int
+	closed  bool
+}
+
+type searchResult struct {
+	results *uci.Results
+	err     error
+}
+
+func NewUCIEngine(path string, options uci.Options, arg ...string) (*UCIEngine, error) {
+	e, err := uci.NewEngine(path, arg...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.SetOptions(options)
+	if err != nil {
+		e.Close()
+		return nil, err
+	}
+	return &UCIEngine{
+		engine:  e,
+		multiPV: options.MultiPV,
+	}, nil
+}
+
+func (u *UCIEngine) SetFEN(fen string) error {
+	return u.engine.SetFEN(fen)
+}
+
+func (u *UCIEngine) Search(ctx context.Context, params SearchParams) ([]uci.ScoreResult, error) {
+	if u.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if params.MultiPV > 0 && params.MultiPV != u.multiPV {
+		if err := u.engine.SendOption("multipv", params.MultiPV); err != nil {
+			return nil, err
+		}
+		u.multiPV = params.MultiPV
+	}
+
+	done := make(chan searchResult, 1)
+	go func() {
+		results, err := u.engine.Go(params.Depth, "", params.MoveTime.Milliseconds(), uci.IncludeLowerbounds|uci.IncludeUpperbounds)
+		done <- searchResult{results, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return res.results.Results, nil
+	case <-ctx.Done():
+		// uci package can't interrupt running search, so engine process is killed and search fails on closed output
+		u.Close()
+		<-done
+		return nil, ctx.Err()
+	}
+}
+
+func (u *UCIEngine) Close() {
+	if u.closed {
+		return
+	}
+	u.closed = true
+	u.engine.Close()
+}
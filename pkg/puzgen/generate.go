@@ -1,19 +1,20 @@
 package puzgen
 
 import (
+	"context"
 	"github.com/freeeve/uci"
 	"github.com/notnil/chess"
 	"sort"
 )
 
-func compareResults(baseRes uci.ScoreResult, cmpRes uci.ScoreResult) bool {
+func compareResults(baseRes uci.ScoreResult, cmpRes uci.ScoreResult, tolerance int) bool {
 	if baseRes.Mate {
 		return cmpRes.Mate && baseRes.Score == cmpRes.Score
 	}
-	return baseRes.Score-cmpRes.Score <= 50
+	return baseRes.Score-cmpRes.Score <= tolerance
 }
 
-func filterResults(results []uci.ScoreResult) []uci.ScoreResult {
+func filterResults(results []uci.ScoreResult, tolerance int) []uci.ScoreResult {
 	sort.Slice(results, func(i, j int) bool {
 		if results[i].Mate {
 			if !results[j].Mate {
@@ -29,14 +30,14 @@ func filterResults(results []uci.ScoreResult) []uci.ScoreResult {
 	baseRes := results[0]
 	filteredResults := make([]uci.ScoreResult, 0)
 	for _, item := range results {
-		if compareResults(baseRes, item) {
+		if compareResults(baseRes, item, tolerance) {
 			filteredResults = append(filteredResults, item)
 		}
 	}
 	return filteredResults
 }
 
-func generateCheckmate(game chess.Game, e *uci.Engine, res uci.ScoreResult, watchedPositions map[string][]Turn) (Turn, error) {
+func generateCheckmate(ctx context.Context, game chess.Game, e Engine, res uci.ScoreResult, watchedPositions map[string][]Turn, opts GeneratorOptions) (Turn, error) {
 	if !res.Mate {
 		return Turn{}, nil
 	}
@@ -70,11 +71,14 @@ func generateCheckmate(game chess.Game, e *uci.Engine, res uci.ScoreResult, watc
 	var ansMoveUci string
 	if len(res.BestMoves) == 1 {
 		e.SetFEN(game.FEN())
-		ansResults, err := e.GoDepth(res.Score, uci.IncludeLowerbounds|uci.IncludeUpperbounds)
+		ansResults, err := e.Search(ctx, opts.searchParams(res.Score))
 		if err != nil {
 			return Turn{}, err
 		}
-		ansMoveUci = ansResults.Results[0].BestMoves[0]
+		if len(ansResults) == 0 || len(ansResults[0].BestMoves) == 0 {
+			return Turn{}, nil
+		}
+		ansMoveUci = ansResults[0].BestMoves[0]
 	} else {
 		ansMoveUci = res.BestMoves[1]
 	}
@@ -90,16 +94,19 @@ func generateCheckmate(game chess.Game, e *uci.Engine, res uci.ScoreResult, watc
 		fen := game.FEN()
 		e.SetFEN(fen)
 
-		results, err := e.GoDepth(res.Score, uci.IncludeLowerbounds|uci.IncludeUpperbounds)
+		results, err := e.Search(ctx, opts.searchParams(res.Score))
 		if err != nil {
 			return Turn{}, err
 		}
+		if len(results) == 0 {
+			return Turn{}, nil
+		}
 
-		filteredResults := filterResults(results.Results)
-		continueTurns := make([]Turn, 0)
+		filteredResults := filterResults(results, opts.ScoreTolerance)
+		continueTurns = make([]Turn, 0)
 
 		for _, filteredResult := range filteredResults {
-			turn, err := generateCheckmate(game, e, filteredResult, watchedPositions)
+			turn, err := generateCheckmate(ctx, game, e, filteredResult, watchedPositions, opts)
 			if err != nil {
 				return Turn{}, err
 			}
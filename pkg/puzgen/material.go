@@ -0,0 +1,118 @@
+package puzgen
+
+import (
+	"context"
+	"github.com/freeeve/uci"
+	"github.com/notnil/chess"
+	"sort"
+)
+
+// maximum number of solver moves in material winning puzzle
+const maxMaterialLength = 4
+
+// lastDepthResults returns the deepest result for every principal variation ordered by MultiPV rank
+func lastDepthResults(results []uci.ScoreResult) []uci.ScoreResult {
+	byPV := make(map[int]uci.ScoreResult)
+	for _, res := range results {
+		if len(res.BestMoves) == 0 {
+			continue
+		}
+		cur, ok := byPV[res.MultiPV]
+		isExact := !res.Lowerbound && !res.Upperbound
+		if !ok || res.Depth > cur.Depth || (res.Depth == cur.Depth && isExact) {
+			byPV[res.MultiPV] = res
+		}
+	}
+	lines := make([]uci.ScoreResult, 0, len(byPV))
+	for _, res := range byPV {
+		lines = append(lines, res)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].MultiPV < lines[j].MultiPV
+	})
+	return lines
+}
+
+// decisiveResult returns best line if it wins at least threshold centipawns compared to the second best line
+func decisiveResult(results []uci.ScoreResult, threshold int) (uci.ScoreResult, bool) {
+	lines := lastDepthResults(results)
+	if len(lines) < 2 {
+		return uci.ScoreResult{}, false
+	}
+	best, second := lines[0], lines[1]
+	if best.Mate || best.Score < threshold {
+		return uci.ScoreResult{}, false
+	}
+	if second.Mate {
+		return best, second.Score < 0
+	}
+	if best.Score-second.Score < threshold {
+		return uci.ScoreResult{}, false
+	}
+	return best, true
+}
+
+func generateMaterial(ctx context.Context, game chess.Game, e Engine, res uci.ScoreResult, opts GeneratorOptions, movesLeft int, watchedPositions map[string][]Turn) (Turn, error) {
+	beginPos := game.Position()
+	firstMove, err := chess.UCINotation{}.Decode(beginPos, res.BestMoves[0])
+	if err != nil {
+		return Turn{}, err
+	}
+
+	lastTurn := Turn{
+		SanNotation:           chess.AlgebraicNotation{}.Encode(beginPos, firstMove),
+		IsLastTurn:            true,
+		AnswerTurnSanNotation: "",
+		ContinueVariations:    nil,
+	}
+	if movesLeft <= 1 || len(res.BestMoves) < 2 {
+		return lastTurn, nil
+	}
+
+	game.Move(firstMove)
+	if game.Outcome() != chess.NoOutcome {
+		return lastTurn, nil
+	}
+	ansPos := game.Position()
+	ansMove, err := chess.UCINotation{}.Decode(ansPos, res.BestMoves[1])
+	if err != nil {
+		return Turn{}, err
+	}
+	game.Move(ansMove)
+	if game.Outcome() != chess.NoOutcome {
+		return lastTurn, nil
+	}
+
+	fen := game.FEN()
+	if _, exists := watchedPositions[fen]; exists {
+		return lastTurn, nil
+	}
+	err = e.SetFEN(fen)
+	if err != nil {
+		return Turn{}, err
+	}
+	results, err := e.Search(ctx, opts.searchParams(opts.Depth))
+	if err != nil {
+		return Turn{}, err
+	}
+
+	// combination is over when there is no single move winning more than the others
+	nextRes, ok := decisiveResult(results, opts.MaterialThreshold)
+	if !ok {
+		return lastTurn, nil
+	}
+	continueTurn, err := generateMaterial(ctx, game, e, nextRes, opts, movesLeft-1, watchedPositions)
+	if err != nil {
+		return Turn{}, err
+	}
+	continueTurns := []Turn{continueTurn}
+	watchedPositions[fen] = continueTurns
+
+	resTurn := Turn{
+		SanNotation:           chess.AlgebraicNotation{}.Encode(beginPos, firstMove),
+		IsLastTurn:            false,
+		AnswerTurnSanNotation: chess.AlgebraicNotation{}.Encode(ansPos, ansMove),
+		ContinueVariations:    continueTurns,
+	}
+	return resTurn, nil
+}
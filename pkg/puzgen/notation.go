@@ -0,0 +1,71 @@
+package puzgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatSolution writes solution tree in PGN-like movetext, alternative solver moves are put in parentheses
+func FormatSolution(task Task) string {
+	moveNumber := 1
+	if fields := strings.Fields(task.StartFEN); len(fields) == 6 {
+		if n, err := strconv.Atoi(fields[5]); err == nil && n > 0 {
+			moveNumber = n
+		}
+	}
+	return formatTurns(task.FirstPossibleTurns, moveNumber, task.IsWhiteTurn, true)
+}
+
+func formatTurns(turns []Turn, moveNumber int, isWhite bool, numbered bool) string {
+	if len(turns) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	main := turns[0]
+	if isWhite {
+		sb.WriteString(fmt.Sprintf("%d. ", moveNumber))
+	} else if numbered {
+		sb.WriteString(fmt.Sprintf("%d... ", moveNumber))
+	}
+	sb.WriteString(main.SanNotation)
+
+	for _, alt := range turns[1:] {
+		sb.WriteString(" (")
+		sb.WriteString(formatTurns([]Turn{alt}, moveNumber, isWhite, true))
+		sb.WriteString(")")
+	}
+
+	if main.IsLastTurn || main.AnswerTurnSanNotation == "" {
+		return sb.String()
+	}
+	sb.WriteString(" ")
+	if !isWhite {
+		// white answers black solver with the next move number
+		sb.WriteString(fmt.Sprintf("%d. ", moveNumber+1))
+	}
+	sb.WriteString(main.AnswerTurnSanNotation)
+
+	rest := formatTurns(main.ContinueVariations, moveNumber+1, isWhite, false)
+	if rest != "" {
+		sb.WriteString(" ")
+		sb.WriteString(rest)
+	}
+	return sb.String()
+}
+
+// MainLine returns SAN moves of the first solution line including defender answers
+func MainLine(task Task) []string {
+	moves := make([]string, 0)
+	turns := task.FirstPossibleTurns
+	for len(turns) > 0 {
+		turn := turns[0]
+		moves = append(moves, turn.SanNotation)
+		if turn.IsLastTurn || turn.AnswerTurnSanNotation == "" {
+			break
+		}
+		moves = append(moves, turn.AnswerTurnSanNotation)
+		turns = turn.ContinueVariations
+	}
+	return moves
+}
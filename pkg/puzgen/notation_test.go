@@ -0,0 +1,84 @@
+package puzgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatSolution(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     Task
+		expected string
+	}{
+		{
+			"white solver with alternative",
+			Task{
+				StartFEN:    "7k/8/8/8/8/8/1R6/R5K1 w - - 0 1",
+				IsWhiteTurn: true,
+				FirstPossibleTurns: []Turn{
+					{
+						SanNotation:           "Ra7",
+						AnswerTurnSanNotation: "Kg8",
+						ContinueVariations:    []Turn{{SanNotation: "Rb8", IsLastTurn: true}},
+					},
+					{
+						SanNotation:           "Rb7",
+						AnswerTurnSanNotation: "Kg8",
+						ContinueVariations:    []Turn{{SanNotation: "Ra8", IsLastTurn: true}},
+					},
+				},
+			},
+			"1. Ra7 (1. Rb7 Kg8 2. Ra8) Kg8 2. Rb8",
+		},
+		{
+			"black solver",
+			Task{
+				StartFEN: "3rk3/8/8/8/8/8/3q4/3RK3 b - - 0 5",
+				FirstPossibleTurns: []Turn{{
+					SanNotation:           "Qxd1",
+					AnswerTurnSanNotation: "Kxd1",
+					ContinueVariations:    []Turn{{SanNotation: "Kd7", IsLastTurn: true}},
+				}},
+			},
+			"5... Qxd1 6. Kxd1 Kd7",
+		},
+		{
+			"single move without move number in FEN",
+			Task{
+				StartFEN:           "4k3/8/8/3q4/8/8/8/3RK3 w - -",
+				IsWhiteTurn:        true,
+				FirstPossibleTurns: []Turn{{SanNotation: "Rxd5", IsLastTurn: true}},
+			},
+			"1. Rxd5",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := FormatSolution(test.task); result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestMainLine(t *testing.T) {
+	task := Task{
+		FirstPossibleTurns: []Turn{
+			{
+				SanNotation:           "Ra7",
+				AnswerTurnSanNotation: "Kg8",
+				ContinueVariations:    []Turn{{SanNotation: "Rb8", IsLastTurn: true}},
+			},
+			{SanNotation: "Rb7", AnswerTurnSanNotation: "Kg8"},
+		},
+	}
+	expected := []string{"Ra7", "Kg8", "Rb8"}
+	moves := MainLine(task)
+	if strings.Join(moves, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, moves)
+	}
+	if moves := MainLine(Task{}); len(moves) != 0 {
+		t.Errorf("expected no moves for empty task, got %v", moves)
+	}
+}
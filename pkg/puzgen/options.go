@@ -0,0 +1,92 @@
+package puzgen
+
+import (
+	"github.com/freeeve/uci"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/notnil/chess"
+	"time"
+)
+
+type GeneratorOptions struct {
+	// Depth is engine search depth for every analyzed position
+	Depth int
+	// MoveTime limits search time per position, zero means no limit
+	MoveTime time.Duration
+	// MultiPV is number of lines engine reports for every position
+	MultiPV int
+	// Hash is engine hash size in MB
+	Hash int
+	// Threads is number of engine threads, zero leaves engine default
+	Threads int
+	// MinMateLength and MaxMateLength bound length of generated checkmates, zero MaxMateLength means no limit
+	MinMateLength int
+	MaxMateLength int
+	// ScoreTolerance is maximal difference in centipawns with the best line for alternative solutions
+	ScoreTolerance int
+	// MaterialThreshold is minimal win of material puzzles in centipawns, zero disables material puzzles
+	MaterialThreshold int
+	// ValidationDepth is search depth used to check solution uniqueness, zero disables validation
+	ValidationDepth int
+	// RejectAmbiguous drops puzzles with ambiguous solution instead of marking them
+	RejectAmbiguous bool
+	// KnownEvalMargin is how far below MaterialThreshold known evaluation of position from game annotations
+	// should be for side to move to skip the position without search, negative value disables skipping
+	KnownEvalMargin int
+}
+
+func DefaultGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{
+		Depth:             6,
+		MultiPV:           6,
+		Hash:              128,
+		MinMateLength:     2,
+		ScoreTolerance:    50,
+		MaterialThreshold: 300,
+		ValidationDepth:   10,
+		KnownEvalMargin:   100,
+	}
+}
+
+func (o GeneratorOptions) engineOptions() uci.Options {
+	return uci.Options{
+		MultiPV: o.MultiPV,
+		Hash:    o.Hash,
+		Threads: o.Threads,
+		Ponder:  false,
+		OwnBook: true,
+	}
+}
+
+func (o GeneratorOptions) searchParams(depth int) SearchParams {
+	return SearchParams{
+		Depth:    depth,
+		MoveTime: o.MoveTime,
+		MultiPV:  o.MultiPV,
+	}
+}
+
+func (o GeneratorOptions) acceptsMate(length int) bool {
+	if length < o.MinMateLength {
+		return false
+	}
+	return o.MaxMateLength == 0 || length <= o.MaxMateLength
+}
+
+// noTaskExpected tells if known evaluation rules out both mate and winning material for side to move
+func (o GeneratorOptions) noTaskExpected(eval *pgn.Eval, turn chess.Color) bool {
+	if eval == nil || o.KnownEvalMargin < 0 {
+		return false
+	}
+	sign := 1
+	if turn == chess.Black {
+		sign = -1
+	}
+	if eval.Mate != 0 {
+		// only opponent has a mate
+		return eval.Mate*sign < 0
+	}
+	if o.MaterialThreshold <= 0 {
+		return true
+	}
+	return eval.Centipawns*sign < o.MaterialThreshold-o.KnownEvalMargin
+}
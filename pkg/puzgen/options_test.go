@@ -0,0 +1,42 @@
+package puzgen
+
+import (
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pgn"
+	"github.com/notnil/chess"
+	"testing"
+)
+
+func TestNoTaskExpected(t *testing.T) {
+	opts := DefaultGeneratorOptions()
+	noMaterial := DefaultGeneratorOptions()
+	noMaterial.MaterialThreshold = 0
+	noSkipping := DefaultGeneratorOptions()
+	noSkipping.KnownEvalMargin = -1
+
+	tests := []struct {
+		name     string
+		opts     GeneratorOptions
+		eval     *pgn.Eval
+		turn     chess.Color
+		expected bool
+	}{
+		{"unknown eval", opts, nil, chess.White, false},
+		{"skipping disabled", noSkipping, &pgn.Eval{Centipawns: 0}, chess.White, false},
+		{"equal position", opts, &pgn.Eval{Centipawns: 0}, chess.White, true},
+		{"below margin", opts, &pgn.Eval{Centipawns: 150}, chess.White, true},
+		{"within margin", opts, &pgn.Eval{Centipawns: 250}, chess.White, false},
+		{"black is winning", opts, &pgn.Eval{Centipawns: -500}, chess.Black, false},
+		{"white is winning on black turn", opts, &pgn.Eval{Centipawns: 500}, chess.Black, true},
+		{"mate for side to move", opts, &pgn.Eval{Mate: -3}, chess.Black, false},
+		{"mate for opponent", opts, &pgn.Eval{Mate: 3}, chess.Black, true},
+		{"material puzzles disabled", noMaterial, &pgn.Eval{Centipawns: 900}, chess.White, true},
+		{"mate with material puzzles disabled", noMaterial, &pgn.Eval{Mate: 2}, chess.White, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if skipped := test.opts.noTaskExpected(test.eval, test.turn); skipped != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package puzgen
+
+import (
+	"errors"
+	"sync"
+)
+
+var errPoolClosed = errors.New("engine pool is closed")
+
+// EnginePool limits number of running engines and reuses them between analyses
+type EnginePool struct {
+	mu      sync.Mutex
+	closed  bool
+	done    chan struct{}
+	slots   chan struct{}
+	idle    chan Engine
+	factory func() (Engine, error)
+}
+
+func NewEnginePool(size int, factory func() (Engine, error)) *EnginePool {
+	if size <= 0 {
+		size = 1
+	}
+	return &EnginePool{
+		done:    make(chan struct{}),
+		slots:   make(chan struct{}, size),
+		idle:    make(chan Engine, size),
+		factory: factory,
+	}
+}
+
+func (p *EnginePool) Size() int {
+	return cap(p.slots)
+}
+
+func (p *EnginePool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// Acquire returns idle engine, starts a new one if limit is not reached or waits until some engine is released.
+// Waiting is stopped when pool is closed
+func (p *EnginePool) Acquire() (Engine, error) {
+	if p.isClosed() {
+		return nil, errPoolClosed
+	}
+	select {
+	case e := <-p.idle:
+		return e, nil
+	default:
+	}
+
+	select {
+	case e := <-p.idle:
+		return e, nil
+	case p.slots <- struct{}{}:
+		if p.isClosed() {
+			<-p.slots
+			return nil, errPoolClosed
+		}
+		e, err := p.factory()
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return e, nil
+	case <-p.done:
+		return nil, errPoolClosed
+	}
+}
+
+// Release returns engine to the pool, engine is closed if pool is already closed
+func (p *EnginePool) Release(e Engine) {
+	// lock is held until engine is in idle channel, so Close can't drain it in between
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.Discard(e)
+		return
+	}
+	p.idle <- e
+}
+
+// Discard closes engine which state is unknown (e.g. after failed search) and frees its slot in the pool
+func (p *EnginePool) Discard(e Engine) {
+	e.Close()
+	<-p.slots
+}
+
+func (p *EnginePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+	for {
+		select {
+		case e := <-p.idle:
+			p.Discard(e)
+		default:
+			return
+		}
+	}
+}
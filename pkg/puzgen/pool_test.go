@@ -0,0 +1,196 @@
+package puzgen
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPool returns pool of scripted engines and list of all engines it started
+func newTestPool(size int) (*EnginePool, func() []*ScriptedEngine) {
+	var mu sync.Mutex
+	started := make([]*ScriptedEngine, 0)
+	pool := NewEnginePool(size, func() (Engine, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		e := NewScriptedEngine(nil)
+		started = append(started, e)
+		return e, nil
+	})
+	return pool, func() []*ScriptedEngine {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*ScriptedEngine(nil), started...)
+	}
+}
+
+func TestEnginePoolReuse(t *testing.T) {
+	pool, started := newTestPool(2)
+	defer pool.Close()
+
+	first, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(first)
+	second, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Error("expected released engine to be reused")
+	}
+	if n := len(started()); n != 1 {
+		t.Errorf("expected 1 started engine, got %d", n)
+	}
+	pool.Release(second)
+}
+
+func TestEnginePoolSizeLimit(t *testing.T) {
+	pool, started := newTestPool(2)
+	defer pool.Close()
+
+	first, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan Engine)
+	go func() {
+		e, err := pool.Acquire()
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- e
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("third engine is acquired while pool is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Release(second)
+	select {
+	case e := <-acquired:
+		if e != second {
+			t.Error("expected waiting acquire to get released engine")
+		}
+		pool.Release(e)
+	case <-time.After(time.Second):
+		t.Fatal("acquire isn't woken up by release")
+	}
+	pool.Release(first)
+
+	if n := len(started()); n != 2 {
+		t.Errorf("expected 2 started engines, got %d", n)
+	}
+}
+
+func TestEnginePoolDiscard(t *testing.T) {
+	pool, started := newTestPool(1)
+	defer pool.Close()
+
+	first, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Discard(first)
+	second, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || !first.(*ScriptedEngine).Closed {
+		t.Error("expected discarded engine to be closed and replaced")
+	}
+	if n := len(started()); n != 2 {
+		t.Errorf("expected 2 started engines, got %d", n)
+	}
+	pool.Release(second)
+}
+
+func TestEnginePoolClose(t *testing.T) {
+	pool, started := newTestPool(2)
+
+	idle, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(idle)
+
+	pool.Close()
+	if !idle.(*ScriptedEngine).Closed {
+		t.Error("expected idle engine to be closed with pool")
+	}
+	// engine released after close isn't returned to the pool
+	pool.Release(busy)
+	if !busy.(*ScriptedEngine).Closed {
+		t.Error("expected engine released after close to be closed")
+	}
+	if _, err := pool.Acquire(); err == nil {
+		t.Error("expected error acquiring from closed pool")
+	}
+	if n := len(started()); n != 2 {
+		t.Errorf("expected 2 started engines, got %d", n)
+	}
+	pool.Close()
+}
+
+func TestEnginePoolCloseWakesAcquire(t *testing.T) {
+	pool, _ := newTestPool(1)
+
+	e, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error)
+	go func() {
+		_, err := pool.Acquire()
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	pool.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected error for acquire waiting on closed pool")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting acquire isn't stopped by close")
+	}
+	pool.Release(e)
+}
+
+func TestEnginePoolConcurrentRelease(t *testing.T) {
+	pool, started := newTestPool(4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, err := pool.Acquire()
+			if err != nil {
+				return
+			}
+			pool.Release(e)
+		}()
+	}
+	pool.Close()
+	wg.Wait()
+
+	// every engine is closed whether it was idle on close or released after it
+	for _, e := range started() {
+		if !e.Closed {
+			t.Error("engine is left running after pool is closed")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package puzgen
+
+import (
+	"context"
+	"github.com/freeeve/uci"
+)
+
+// ScriptedEngine is an Engine which answers with prepared results instead of running real search.
+// Positions without prepared results are reported as having no lines at all.
+type ScriptedEngine struct {
+	Results  map[string][]uci.ScoreResult
+	Searches []SearchParams
+	Closed   bool
+
+	fen string
+}
+
+func NewScriptedEngine(results map[string][]uci.ScoreResult) *ScriptedEngine {
+	return &ScriptedEngine{
+		Results:  results,
+		Searches: make([]SearchParams, 0),
+	}
+}
+
+func (s *ScriptedEngine) SetFEN(fen string) error {
+	s.fen = fen
+	return nil
+}
+
+func (s *ScriptedEngine) Search(ctx context.Context, params SearchParams) ([]uci.ScoreResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.Searches = append(s.Searches, params)
+	results := s.Results[s.fen]
+	copied := make([]uci.ScoreResult, len(results))
+	copy(copied, results)
+	return copied, nil
+}
+
+func (s *ScriptedEngine) Close() {
+	s.Closed = true
+}
@@ -1,22 +1,75 @@
 package puzgen
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/rating"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strings"
+)
+
+type Generator string
+
+const (
+	CheckmateGenerator Generator = "checkmate"
+	MaterialGenerator  Generator = "material"
 )
 
 type Task struct {
-	StartFEN           string   `json:"start_fen" bson:"start_fen"`
-	FirstPossibleTurns []Turn   `json:"first_possible_turns" bson:"first_possible_turns"`
-	IsWhiteTurn        bool     `json:"is_white_turn" bson:"is_white_turn"`
-	GameData           GameData `json:"game_data" bson:"game_data"`
-	TargetELO          int      `json:"target_elo" bson:"target_elo"`
+	ID                 string         `json:"id,omitempty" bson:"_id,omitempty"`
+	StartFEN           string         `json:"start_fen" bson:"start_fen"`
+	FirstPossibleTurns []Turn         `json:"first_possible_turns" bson:"first_possible_turns"`
+	IsWhiteTurn        bool           `json:"is_white_turn" bson:"is_white_turn"`
+	GameData           GameData       `json:"game_data" bson:"game_data"`
+	TargetELO          int            `json:"target_elo" bson:"target_elo"`
+	Rating             *rating.Rating `json:"rating,omitempty" bson:"rating,omitempty"`
+	Generator          Generator      `json:"generator" bson:"generator"`
+	Themes             []Theme        `json:"themes" bson:"themes"`
+	Validation         *Validation    `json:"validation,omitempty" bson:"validation,omitempty"`
+	NormalizedFEN      string         `json:"-" bson:"normalized_fen,omitempty"`
+	Sources            []GameData     `json:"sources,omitempty" bson:"sources,omitempty"`
 }
 
+// DefaultGameSource is site of games saved before sources were introduced
+const DefaultGameSource = "lichess"
+
 type GameData struct {
 	WhitePlayer string             `json:"white_player" bson:"white_player"`
 	BlackPlayer string             `json:"black_player" bson:"black_player"`
 	Date        primitive.DateTime `json:"date" bson:"date"`
+	// Source is site where the game was played, player names are identities on that site
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+}
+
+// NormalizeFEN drops halfmove clock and fullmove number from FEN, so same positions reached at different moves are equal
+func NormalizeFEN(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) > 4 {
+		fields = fields[:4]
+	}
+	return strings.Join(fields, " ")
+}
+
+// TaskID derives stable task identifier from its position and first solution moves
+func TaskID(task Task) string {
+	firstMoves := make([]string, 0, len(task.FirstPossibleTurns))
+	for _, turn := range task.FirstPossibleTurns {
+		firstMoves = append(firstMoves, turn.SanNotation)
+	}
+	sort.Strings(firstMoves)
+
+	hash := sha1.Sum([]byte(NormalizeFEN(task.StartFEN) + "|" + strings.Join(firstMoves, ",")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// CurrentRating returns live rating of the task, tasks saved before ratings were introduced start from target elo
+func (t Task) CurrentRating() rating.Rating {
+	if t.Rating == nil {
+		return rating.New(float64(t.TargetELO))
+	}
+	return *t.Rating
 }
 
 func (t Task) String() string {
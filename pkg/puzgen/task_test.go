@@ -0,0 +1,58 @@
+package puzgen
+
+import (
+	"testing"
+)
+
+func TestNormalizeFEN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected string
+	}{
+		{
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3",
+		},
+		{
+			"4k3/8/8/3q4/8/8/8/3RK3 w - - 12 40",
+			"4k3/8/8/3q4/8/8/8/3RK3 w - -",
+		},
+		{
+			"4k3/8/8/3q4/8/8/8/3RK3 w - -",
+			"4k3/8/8/3q4/8/8/8/3RK3 w - -",
+		},
+	}
+	for _, test := range tests {
+		if normalized := NormalizeFEN(test.fen); normalized != test.expected {
+			t.Errorf("NormalizeFEN(%q) = %q, expected %q", test.fen, normalized, test.expected)
+		}
+	}
+}
+
+func TestTaskID(t *testing.T) {
+	task := Task{
+		StartFEN:           "6k1/5ppp/8/8/8/8/8/RR4K1 w - - 0 1",
+		FirstPossibleTurns: []Turn{{SanNotation: "Ra8"}, {SanNotation: "Rb8"}},
+	}
+	id := TaskID(task)
+	if len(id) != 16 {
+		t.Errorf("expected 16 hex digits, got %s", id)
+	}
+
+	sameTask := Task{
+		StartFEN:           "6k1/5ppp/8/8/8/8/8/RR4K1 w - - 5 30",
+		FirstPossibleTurns: []Turn{{SanNotation: "Rb8"}, {SanNotation: "Ra8"}},
+		TargetELO:          2000,
+	}
+	if sameID := TaskID(sameTask); sameID != id {
+		t.Errorf("id shouldn't depend on move counters and order of solutions, got %s and %s", id, sameID)
+	}
+
+	otherTask := Task{
+		StartFEN:           task.StartFEN,
+		FirstPossibleTurns: []Turn{{SanNotation: "Ra8"}},
+	}
+	if otherID := TaskID(otherTask); otherID == id {
+		t.Errorf("tasks with different solutions should have different ids, both got %s", id)
+	}
+}
@@ -0,0 +1,255 @@
+package puzgen
+
+import (
+	"fmt"
+	"github.com/notnil/chess"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Theme string
+
+const (
+	ForkTheme             Theme = "fork"
+	PinTheme              Theme = "pin"
+	SkewerTheme           Theme = "skewer"
+	DiscoveredAttackTheme Theme = "discoveredAttack"
+	DoubleCheckTheme      Theme = "doubleCheck"
+	BackRankMateTheme     Theme = "backRankMate"
+	SmotheredMateTheme    Theme = "smotheredMate"
+	SacrificeTheme        Theme = "sacrifice"
+	UnderpromotionTheme   Theme = "underpromotion"
+
+	mateInPrefix = "mateIn"
+)
+
+// minimal material loss (in pawns) after opponent's answer that is considered a sacrifice
+const sacrificeThreshold = 2
+
+func MateInTheme(n int) Theme {
+	return Theme(fmt.Sprintf("%s%d", mateInPrefix, n))
+}
+
+func IsKnownTheme(theme Theme) bool {
+	switch theme {
+	case ForkTheme, PinTheme, SkewerTheme, DiscoveredAttackTheme, DoubleCheckTheme,
+		BackRankMateTheme, SmotheredMateTheme, SacrificeTheme, UnderpromotionTheme:
+		return true
+	}
+	if !strings.HasPrefix(string(theme), mateInPrefix) {
+		return false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(string(theme), mateInPrefix))
+	return err == nil && n > 0
+}
+
+// ClassifyThemes replays every solution line of the task and returns tactical motifs found in it
+func ClassifyThemes(task Task) ([]Theme, error) {
+	fenFunc, err := chess.FEN(task.StartFEN)
+	if err != nil {
+		return nil, err
+	}
+	startPos := chess.NewGame(fenFunc).Position()
+	solver := startPos.Turn()
+	startBalance := materialBalance(startPos.Board(), solver)
+
+	found := make(map[Theme]bool)
+	for _, turn := range task.FirstPossibleTurns {
+		if err := classifyTurn(startPos, turn, solver, startBalance, found); err != nil {
+			return nil, err
+		}
+	}
+
+	if task.Generator == CheckmateGenerator && len(task.FirstPossibleTurns) > 0 {
+		mateLength := findMinDepth(task.FirstPossibleTurns[0])
+		for _, turn := range task.FirstPossibleTurns {
+			if depth := findMinDepth(turn); depth < mateLength {
+				mateLength = depth
+			}
+		}
+		found[MateInTheme(mateLength)] = true
+	}
+
+	themes := make([]Theme, 0, len(found))
+	for theme := range found {
+		themes = append(themes, theme)
+	}
+	sort.Slice(themes, func(i, j int) bool {
+		return themes[i] < themes[j]
+	})
+	return themes, nil
+}
+
+func classifyTurn(pos *chess.Position, turn Turn, solver chess.Color, startBalance int, found map[Theme]bool) error {
+	move, err := chess.AlgebraicNotation{}.Decode(pos, turn.SanNotation)
+	if err != nil {
+		return err
+	}
+	after := pos.Update(move)
+	for _, theme := range moveThemes(pos, after, move) {
+		found[theme] = true
+	}
+	if after.Status() == chess.Checkmate {
+		for _, theme := range mateThemes(after) {
+			found[theme] = true
+		}
+	}
+
+	if turn.IsLastTurn || turn.AnswerTurnSanNotation == "" {
+		return nil
+	}
+	answer, err := chess.AlgebraicNotation{}.Decode(after, turn.AnswerTurnSanNotation)
+	if err != nil {
+		return err
+	}
+	afterAnswer := after.Update(answer)
+	if materialBalance(afterAnswer.Board(), solver) <= startBalance-sacrificeThreshold {
+		found[SacrificeTheme] = true
+	}
+
+	for _, continueTurn := range turn.ContinueVariations {
+		if err := classifyTurn(afterAnswer, continueTurn, solver, startBalance, found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isValuableTarget checks whether attacking target with attacker is a real threat
+func isValuableTarget(board *chess.Board, attacker chess.Square, target chess.Square) bool {
+	targetPiece := board.Piece(target)
+	if targetPiece.Type() == chess.King {
+		return true
+	}
+	if targetPiece.Type() == chess.Pawn {
+		return false
+	}
+	if pieceValues[targetPiece.Type()] > pieceValues[board.Piece(attacker).Type()] {
+		return true
+	}
+	return len(attackersOf(board, target, targetPiece.Color())) == 0
+}
+
+func moveThemes(before *chess.Position, after *chess.Position, move *chess.Move) []Theme {
+	themes := make([]Theme, 0)
+	mover := before.Turn()
+	opponent := mover.Other()
+	board := after.Board()
+	moved := board.Piece(move.S2())
+
+	if promo := move.Promo(); promo == chess.Knight || promo == chess.Bishop || promo == chess.Rook {
+		themes = append(themes, UnderpromotionTheme)
+	}
+
+	if oppKing := kingSquare(board, opponent); oppKing != chess.NoSquare {
+		if len(attackersOf(board, oppKing, mover)) >= 2 {
+			themes = append(themes, DoubleCheckTheme)
+		}
+	}
+
+	forkTargets := 0
+	for _, target := range attackedSquares(board, move.S2()) {
+		if board.Piece(target).Color() == opponent && isValuableTarget(board, move.S2(), target) {
+			forkTargets++
+		}
+	}
+	if forkTargets >= 2 {
+		themes = append(themes, ForkTheme)
+	}
+
+	for _, d := range sliderDirections(moved.Type()) {
+		front, back := lineBehind(board, move.S2(), d)
+		if front == chess.NoSquare || back == chess.NoSquare {
+			continue
+		}
+		frontPiece, backPiece := board.Piece(front), board.Piece(back)
+		if frontPiece.Color() != opponent || backPiece.Color() != opponent {
+			continue
+		}
+		frontValue, backValue := pieceValues[frontPiece.Type()], pieceValues[backPiece.Type()]
+		if backValue > frontValue {
+			themes = append(themes, PinTheme)
+		} else if frontValue > backValue && backPiece.Type() != chess.Pawn {
+			themes = append(themes, SkewerTheme)
+		}
+	}
+
+	beforeBoard := before.Board()
+	for sq, piece := range board.SquareMap() {
+		if sq == move.S2() || piece.Color() != mover || sliderDirections(piece.Type()) == nil {
+			continue
+		}
+		if beforeBoard.Piece(sq) != piece {
+			continue
+		}
+		discovered := false
+		for _, target := range attackedSquares(board, sq) {
+			if board.Piece(target).Color() != opponent || attacks(beforeBoard, sq, target) {
+				continue
+			}
+			if isValuableTarget(board, sq, target) {
+				discovered = true
+				break
+			}
+		}
+		if discovered {
+			themes = append(themes, DiscoveredAttackTheme)
+			break
+		}
+	}
+	return themes
+}
+
+func mateThemes(pos *chess.Position) []Theme {
+	themes := make([]Theme, 0)
+	board := pos.Board()
+	mated := pos.Turn()
+	king := kingSquare(board, mated)
+	if king == chess.NoSquare {
+		return themes
+	}
+	checkers := attackersOf(board, king, mated.Other())
+	if len(checkers) != 1 {
+		return themes
+	}
+	checker := board.Piece(checkers[0])
+
+	if checker.Type() == chess.Knight {
+		smothered := true
+		for _, d := range queenDirections {
+			if sq, ok := shift(king, d); ok && board.Piece(sq).Color() != mated {
+				smothered = false
+				break
+			}
+		}
+		if smothered {
+			themes = append(themes, SmotheredMateTheme)
+		}
+	}
+
+	backRank, forward := chess.Rank1, 1
+	if mated == chess.Black {
+		backRank, forward = chess.Rank8, -1
+	}
+	if king.Rank() == backRank && checkers[0].Rank() == backRank &&
+		(checker.Type() == chess.Rook || checker.Type() == chess.Queen) {
+		blockedByOwn := false
+		escapes := false
+		for _, fileShift := range []int{-1, 0, 1} {
+			sq, ok := shift(king, direction{fileShift, forward})
+			if !ok {
+				continue
+			}
+			if board.Piece(sq).Color() == mated {
+				blockedByOwn = true
+			} else if len(attackersOf(board, sq, mated.Other())) == 0 {
+				escapes = true
+			}
+		}
+		if blockedByOwn && !escapes {
+			themes = append(themes, BackRankMateTheme)
+		}
+	}
+	return themes
+}
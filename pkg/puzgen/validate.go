@@ -0,0 +1,154 @@
+package puzgen
+
+import (
+	"context"
+	"fmt"
+	"github.com/freeeve/uci"
+	"github.com/notnil/chess"
+)
+
+type Validation struct {
+	Depth     int    `json:"depth" bson:"depth"`
+	Ambiguous bool   `json:"ambiguous" bson:"ambiguous"`
+	Reason    string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// ValidateTask re-searches every node of solution tree with opts.ValidationDepth
+// and checks that solver has no alternative as good as the solution and defender has no better reply
+func ValidateTask(ctx context.Context, task Task, e Engine, opts GeneratorOptions) (Validation, error) {
+	fenFunc, err := chess.FEN(task.StartFEN)
+	if err != nil {
+		return Validation{}, err
+	}
+	pos := chess.NewGame(fenFunc).Position()
+
+	reason, err := validateSolverMove(ctx, pos, task.FirstPossibleTurns, task.Generator, e, opts)
+	if err != nil {
+		return Validation{}, err
+	}
+	return Validation{
+		Depth:     opts.ValidationDepth,
+		Ambiguous: reason != "",
+		Reason:    reason,
+	}, nil
+}
+
+func searchPosition(ctx context.Context, pos *chess.Position, e Engine, opts GeneratorOptions) ([]uci.ScoreResult, error) {
+	if err := e.SetFEN(pos.String()); err != nil {
+		return nil, err
+	}
+	results, err := e.Search(ctx, opts.searchParams(opts.ValidationDepth))
+	if err != nil {
+		return nil, err
+	}
+	return lastDepthResults(results), nil
+}
+
+func lineSan(pos *chess.Position, line uci.ScoreResult) (string, error) {
+	move, err := chess.UCINotation{}.Decode(pos, line.BestMoves[0])
+	if err != nil {
+		return "", err
+	}
+	return chess.AlgebraicNotation{}.Encode(pos, move), nil
+}
+
+// isAlternativeSolution checks whether alt line is as good for solver as solution line
+func isAlternativeSolution(solution uci.ScoreResult, alt uci.ScoreResult, generator Generator, opts GeneratorOptions) bool {
+	if generator == MaterialGenerator {
+		if alt.Mate {
+			return alt.Score > 0
+		}
+		return !solution.Mate && solution.Score-alt.Score < opts.MaterialThreshold
+	}
+	return compareResults(solution, alt, opts.ScoreTolerance)
+}
+
+func validateSolverMove(ctx context.Context, pos *chess.Position, turns []Turn, generator Generator, e Engine, opts GeneratorOptions) (string, error) {
+	lines, err := searchPosition(ctx, pos, e, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("no lines found at depth %d in %s", opts.ValidationDepth, pos.String()), nil
+	}
+
+	accepted := make(map[string]bool)
+	for _, turn := range turns {
+		accepted[turn.SanNotation] = true
+	}
+	sans := make([]string, len(lines))
+	solutionInd := -1
+	for i, line := range lines {
+		sans[i], err = lineSan(pos, line)
+		if err != nil {
+			return "", err
+		}
+		if solutionInd == -1 && accepted[sans[i]] {
+			solutionInd = i
+		}
+	}
+	if solutionInd == -1 {
+		return fmt.Sprintf("solution is not among %d best moves at depth %d in %s", len(lines), opts.ValidationDepth, pos.String()), nil
+	}
+	if solutionInd > 0 {
+		return fmt.Sprintf("alternative move %s is better than solution in %s", sans[0], pos.String()), nil
+	}
+
+	for i, line := range lines {
+		if !accepted[sans[i]] && isAlternativeSolution(lines[solutionInd], line, generator, opts) {
+			return fmt.Sprintf("alternative move %s is as good as solution in %s", sans[i], pos.String()), nil
+		}
+	}
+
+	for _, turn := range turns {
+		move, err := chess.AlgebraicNotation{}.Decode(pos, turn.SanNotation)
+		if err != nil {
+			return "", err
+		}
+		reason, err := validateDefenderMove(ctx, pos.Update(move), turn, generator, e, opts)
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+	return "", nil
+}
+
+func validateDefenderMove(ctx context.Context, pos *chess.Position, turn Turn, generator Generator, e Engine, opts GeneratorOptions) (string, error) {
+	if turn.IsLastTurn || turn.AnswerTurnSanNotation == "" {
+		return "", nil
+	}
+	lines, err := searchPosition(ctx, pos, e, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	bestSan, err := lineSan(pos, lines[0])
+	if err != nil {
+		return "", err
+	}
+	if bestSan != turn.AnswerTurnSanNotation {
+		var answerLine *uci.ScoreResult
+		for i, line := range lines {
+			san, err := lineSan(pos, line)
+			if err != nil {
+				return "", err
+			}
+			if san == turn.AnswerTurnSanNotation {
+				answerLine = &lines[i]
+				break
+			}
+		}
+		if answerLine == nil || !compareResults(lines[0], *answerLine, opts.ScoreTolerance) {
+			return fmt.Sprintf("defender reply %s is better than %s in %s", bestSan, turn.AnswerTurnSanNotation, pos.String()), nil
+		}
+	}
+
+	answer, err := chess.AlgebraicNotation{}.Decode(pos, turn.AnswerTurnSanNotation)
+	if err != nil {
+		return "", err
+	}
+	return validateSolverMove(ctx, pos.Update(answer), turn.ContinueVariations, generator, e, opts)
+}
@@ -0,0 +1,117 @@
+package rating
+
+import "math"
+
+const (
+	DefaultRating     = 1500
+	DefaultDeviation  = 350
+	DefaultVolatility = 0.06
+
+	// glicko2Scale converts ratings between Glicko and Glicko-2 scales
+	glicko2Scale = 173.7178
+	// tau constrains volatility change over time
+	tau     = 0.5
+	epsilon = 0.000001
+)
+
+// Rating is a Glicko-2 rating of a player or a puzzle
+type Rating struct {
+	Rating     float64 `json:"rating" bson:"rating"`
+	Deviation  float64 `json:"deviation" bson:"deviation"`
+	Volatility float64 `json:"volatility" bson:"volatility"`
+}
+
+func New(rating float64) Rating {
+	return Rating{
+		Rating:     rating,
+		Deviation:  DefaultDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+func Default() Rating {
+	return New(DefaultRating)
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expectedScore(mu float64, muOpponent float64, phiOpponent float64) float64 {
+	return 1 / (1 + math.Exp(-g(phiOpponent)*(mu-muOpponent)))
+}
+
+// Update returns new rating of player after single game against opponent with given score (1 for win, 0 for loss)
+func Update(player Rating, opponent Rating, score float64) Rating {
+	return updatePeriod(player, []result{{opponent, score}})
+}
+
+type result struct {
+	opponent Rating
+	score    float64
+}
+
+// updatePeriod returns new rating of player after all games of rating period (steps 2-8 of Glicko-2 paper)
+func updatePeriod(player Rating, results []result) Rating {
+	mu := (player.Rating - DefaultRating) / glicko2Scale
+	phi := player.Deviation / glicko2Scale
+	sigma := player.Volatility
+
+	var vInv, improvement float64
+	for _, res := range results {
+		muOpponent := (res.opponent.Rating - DefaultRating) / glicko2Scale
+		phiOpponent := res.opponent.Deviation / glicko2Scale
+		gOpponent := g(phiOpponent)
+		expected := expectedScore(mu, muOpponent, phiOpponent)
+		vInv += gOpponent * gOpponent * expected * (1 - expected)
+		improvement += gOpponent * (res.score - expected)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	newSigma := newVolatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*improvement
+
+	return Rating{
+		Rating:     newMu*glicko2Scale + DefaultRating,
+		Deviation:  math.Min(newPhi*glicko2Scale, DefaultDeviation),
+		Volatility: newSigma,
+	}
+}
+
+// newVolatility finds new volatility with Illinois algorithm (step 5 of Glicko-2 paper)
+func newVolatility(phi float64, sigma float64, v float64, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
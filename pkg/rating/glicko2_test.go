@@ -0,0 +1,45 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGlickmanExample reproduces example calculation from "Example of the Glicko-2 system" by Mark Glickman
+func TestGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []result{
+		{Rating{Rating: 1400, Deviation: 30}, 1},
+		{Rating{Rating: 1550, Deviation: 100}, 0},
+		{Rating{Rating: 1700, Deviation: 300}, 0},
+	}
+
+	r := updatePeriod(player, results)
+	if math.Abs(r.Rating-1464.06) > 0.01 {
+		t.Errorf("expected rating 1464.06, got %.4f", r.Rating)
+	}
+	if math.Abs(r.Deviation-151.52) > 0.01 {
+		t.Errorf("expected deviation 151.52, got %.4f", r.Deviation)
+	}
+	if math.Abs(r.Volatility-0.05999) > 0.00001 {
+		t.Errorf("expected volatility 0.05999, got %.6f", r.Volatility)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	player := Default()
+	puzzle := New(1700)
+
+	won := Update(player, puzzle, 1)
+	lost := Update(player, puzzle, 0)
+	if won.Rating <= player.Rating || lost.Rating >= player.Rating {
+		t.Errorf("expected rating to grow after win and drop after loss, got %.2f and %.2f", won.Rating, lost.Rating)
+	}
+	// win against stronger opponent is worth more than loss costs
+	if won.Rating-player.Rating <= player.Rating-lost.Rating {
+		t.Errorf("expected upset win to gain more than loss costs, got +%.2f and -%.2f", won.Rating-player.Rating, player.Rating-lost.Rating)
+	}
+	if won.Deviation >= player.Deviation || won.Deviation > DefaultDeviation {
+		t.Errorf("expected deviation to shrink after game, got %.2f", won.Deviation)
+	}
+}
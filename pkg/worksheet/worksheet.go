@@ -0,0 +1,154 @@
+package worksheet
+
+import (
+	"fmt"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/diagram"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/pdf"
+	"github.com/gmkornilov/chess-puzzle-book-backend/pkg/puzgen"
+	"image/color"
+	"io"
+)
+
+const (
+	margin      = 40.0
+	headerSize  = 16.0
+	captionSize = 9.0
+	answerSize  = 10.0
+	lineHeight  = 1.3
+
+	columns     = 2
+	rows        = 3
+	squareSize  = 21.0
+	boardSize   = 8 * squareSize
+	captionGap  = 14.0
+	boardStroke = 0.6
+)
+
+// Render writes tasks to PDF as worksheet with diagrams, six per page, followed by answer key
+func Render(w io.Writer, title string, tasks []puzgen.Task) error {
+	doc := pdf.NewDocument()
+	cellWidth := (pdf.PageWidth - 2*margin) / columns
+	top := margin + 2*headerSize
+	cellHeight := (pdf.PageHeight - top - margin) / rows
+
+	var page *pdf.Page
+	for i, task := range tasks {
+		cell := i % (columns * rows)
+		if cell == 0 {
+			page = doc.AddPage()
+			page.Text(margin, margin+headerSize, pdf.Bold, headerSize, title)
+		}
+		x := margin + float64(cell%columns)*cellWidth + (cellWidth-boardSize)/2
+		y := top + float64(cell/columns)*cellHeight
+		if err := drawTask(page, x, y, i+1, task); err != nil {
+			return fmt.Errorf("task %s: %w", task.ID, err)
+		}
+	}
+
+	writeAnswers(doc, tasks)
+	return doc.Write(w)
+}
+
+func drawTask(page *pdf.Page, x float64, y float64, number int, task puzgen.Task) error {
+	d, err := diagram.FromTask(task)
+	if err != nil {
+		return err
+	}
+	drawBoard(page, x, y, d)
+
+	page.Gray(0, 0)
+	captionY := y + boardSize + captionGap
+	side := "White"
+	if !task.IsWhiteTurn {
+		side = "Black"
+	}
+	page.Text(x, captionY, pdf.Bold, captionSize, fmt.Sprintf("%d. %s to move", number, side))
+	if source := sourceCaption(task.GameData); source != "" {
+		page.Text(x, captionY+captionSize*lineHeight, pdf.Regular, captionSize, source)
+	}
+	return nil
+}
+
+func sourceCaption(game puzgen.GameData) string {
+	if game.WhitePlayer == "" && game.BlackPlayer == "" {
+		return ""
+	}
+	caption := fmt.Sprintf("%s - %s", game.WhitePlayer, game.BlackPlayer)
+	if game.Date != 0 {
+		caption += ", " + game.Date.Time().UTC().Format(puzgen.Layout)
+	}
+	return caption
+}
+
+// pdfCanvas draws diagrams on PDF page
+type pdfCanvas struct {
+	page *pdf.Page
+}
+
+func components(c color.Color) (float64, float64, float64) {
+	if c == nil {
+		return 0, 0, 0
+	}
+	r, g, b, _ := c.RGBA()
+	return float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff
+}
+
+func (p pdfCanvas) setColors(fill color.Color, stroke color.Color) {
+	fr, fg, fb := components(fill)
+	sr, sg, sb := components(stroke)
+	p.page.RGB(fr, fg, fb, sr, sg, sb)
+}
+
+func (p pdfCanvas) Rect(x float64, y float64, w float64, h float64, fill color.Color) {
+	p.setColors(fill, nil)
+	p.page.Rect(x, y, w, h, true, false)
+}
+
+func (p pdfCanvas) Polygon(points []diagram.Point, fill color.Color, stroke color.Color, strokeWidth float64) {
+	p.setColors(fill, stroke)
+	p.page.LineWidth(strokeWidth)
+	xs, ys := make([]float64, len(points)), make([]float64, len(points))
+	for i, point := range points {
+		xs[i], ys[i] = point.X, point.Y
+	}
+	p.page.Polygon(xs, ys, fill != nil, stroke != nil)
+}
+
+func (p pdfCanvas) Text(x float64, y float64, size float64, text string, fill color.Color) {
+	p.setColors(fill, nil)
+	p.page.Text(x-pdf.TextWidth(pdf.Bold, size, text)/2, y+size*0.35, pdf.Bold, size, text)
+}
+
+func drawBoard(page *pdf.Page, x float64, y float64, d *diagram.Diagram) {
+	d.Draw(pdfCanvas{page}, x, y, boardSize, diagram.Options{Coordinates: true})
+	page.Gray(0, 0)
+	page.LineWidth(boardStroke)
+	page.Rect(x, y, boardSize, boardSize, false, true)
+}
+
+func writeAnswers(doc *pdf.Document, tasks []puzgen.Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	page := doc.AddPage()
+	page.Gray(0, 0)
+	page.Text(margin, margin+headerSize, pdf.Bold, headerSize, "Answers")
+	y := margin + 2*headerSize + answerSize
+	step := answerSize * lineHeight
+	width := pdf.PageWidth - 2*margin
+
+	for i, task := range tasks {
+		lines := pdf.WrapText(pdf.Regular, answerSize, fmt.Sprintf("%d. %s", i+1, puzgen.FormatSolution(task)), width)
+		if y+float64(len(lines))*step > pdf.PageHeight-margin {
+			page = doc.AddPage()
+			page.Gray(0, 0)
+			y = margin + answerSize
+		}
+		page.Text(margin, y, pdf.Regular, answerSize, lines[0])
+		for _, line := range lines[1:] {
+			y += step
+			page.Text(margin+answerSize, y, pdf.Regular, answerSize, line)
+		}
+		y += step
+	}
+}